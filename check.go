@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ytdTolerance absorbs the rounding of DECIMAL(12, 2) sums read as floats.
+const ytdTolerance = 0.005
+
+// consistencyCondition is one TPC-C consistency condition, adapted to the
+// split tables. check reports a violation for every warehouse or district it
+// does not hold in.
+type consistencyCondition struct {
+	Name        string
+	Description string
+	violations  int
+}
+
+// checkCommand verifies the consistency conditions on the database (or on
+// the freshly populated memory backend) and fails when any is violated. The
+// NewOrder and Payment handlers commit in several steps, with Payment's ytd
+// updates left to the compensator, so run it once the compensator is done.
+func checkCommand(cfg *Config, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: check")
+	}
+	store, err := OpenStore(cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	ytds, err := store.GetWarehouseYtds(ctx)
+	if err != nil {
+		return fmt.Errorf("get w_ytd failed: %v", err)
+	}
+	states, err := store.GetDistrictStates(ctx)
+	if err != nil {
+		return fmt.Errorf("get district states failed: %v", err)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Wid != states[j].Wid {
+			return states[i].Wid < states[j].Wid
+		}
+		return states[i].Did < states[j].Did
+	})
+
+	wYtd := &consistencyCondition{Name: "w_ytd", Description: "w_ytd equals the sum of d_ytd of the warehouse"}
+	nextOId := &consistencyCondition{Name: "next_o_id", Description: "d_next_o_id - 1 equals max(o_id) of the district"}
+	olCnt := &consistencyCondition{Name: "ol_cnt", Description: "o_ol_cnt equals the number of lines of the order"}
+	delivery := &consistencyCondition{Name: "delivery", Description: "o_carrier_id is null exactly when ol_delivery_d is null on every line"}
+	balance := &consistencyCondition{Name: "balance", Description: "c_balance + c_ytd_payment equals the amount of the customer's delivered orders"}
+	conditions := []*consistencyCondition{wYtd, nextOId, olCnt, delivery, balance}
+
+	violate := func(c *consistencyCondition, format string, args ...interface{}) {
+		c.violations++
+		logs.Printf("%s violated: %s", c.Name, fmt.Sprintf(format, args...))
+	}
+
+	dYtds := make(map[int64]float64, len(ytds))
+	for _, ds := range states {
+		dYtds[ds.Wid] += ds.DYtd
+	}
+	wids := make([]int64, 0, len(dYtds))
+	for wid := range dYtds {
+		wids = append(wids, wid)
+	}
+	for wid := range ytds {
+		if _, ok := dYtds[wid]; !ok {
+			wids = append(wids, wid)
+		}
+	}
+	sort.Slice(wids, func(i, j int) bool { return wids[i] < wids[j] })
+	for _, wid := range wids {
+		wytd, ok := ytds[wid]
+		if !ok {
+			violate(wYtd, "warehouse %v has districts but no w_ytd", wid)
+			continue
+		}
+		if math.Abs(wytd-dYtds[wid]) > ytdTolerance {
+			violate(wYtd, "warehouse %v: w_ytd %.2f, sum of d_ytd %.2f", wid, wytd, dYtds[wid])
+		}
+	}
+
+	for _, ds := range states {
+		if ds.NextOId-1 != ds.MaxOId {
+			violate(nextOId, "district %v/%v: d_next_o_id - 1 = %v, max(o_id) = %v", ds.Wid, ds.Did, ds.NextOId-1, ds.MaxOId)
+		}
+		if ds.OlCnt.Count > 0 {
+			violate(olCnt, "district %v/%v: %v orders, e.g. o_id %v", ds.Wid, ds.Did, ds.OlCnt.Count, ds.OlCnt.ExampleId)
+		}
+		if ds.Delivery.Count > 0 {
+			violate(delivery, "district %v/%v: %v orders, e.g. o_id %v", ds.Wid, ds.Did, ds.Delivery.Count, ds.Delivery.ExampleId)
+		}
+		if ds.Balance.Count > 0 {
+			violate(balance, "district %v/%v: %v customers, e.g. c_id %v", ds.Wid, ds.Did, ds.Balance.Count, ds.Balance.ExampleId)
+		}
+	}
+
+	total := 0
+	logs.Printf("checked %v warehouses, %v districts", len(wids), len(states))
+	for _, c := range conditions {
+		status := "ok"
+		if c.violations > 0 {
+			status = fmt.Sprintf("%v violations", c.violations)
+		}
+		logs.Printf("  %-10s %-14s %s", c.Name, status, c.Description)
+		total += c.violations
+	}
+	if total > 0 {
+		return fmt.Errorf("%v consistency violations", total)
+	}
+	return nil
+}
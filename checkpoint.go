@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the progress of one client, enough to resume it after the
+// process died: where it was in its commands and what it measured so far.
+// Commands executed after the last checkpoint run again on resume.
+type Checkpoint struct {
+	ClientId   int       `json:"client_id"`
+	File       string    `json:"file"`
+	ConfigHash string    `json:"config_hash"`
+	Time       time.Time `json:"time"`
+	// Done is set when the client finished its commands.
+	Done     bool     `json:"done"`
+	Progress Progress `json:"progress"`
+	// LastCommitted is the line of the last committed command in its file,
+	// or the number of generated commands up to it.
+	LastCommitted int64          `json:"last_committed"`
+	Metrics       *ClientMetrics `json:"metrics"`
+	Window        *windowState   `json:"window"`
+}
+
+func (w *MetricsWriter) checkpointPath(clientId int) string {
+	return filepath.Join(w.RunDir(), fmt.Sprintf("checkpoint-%v.json", clientId))
+}
+
+// WriteCheckpoint replaces the checkpoint of a client atomically, so that a
+// crash while writing leaves the previous one.
+func (w *MetricsWriter) WriteCheckpoint(c *Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	path := w.checkpointPath(c.ClientId)
+	tmp, err := os.CreateTemp(w.RunDir(), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadCheckpoint returns the checkpoint of a client, or nil if it has none.
+func (w *MetricsWriter) ReadCheckpoint(clientId int) (*Checkpoint, error) {
+	data, err := os.ReadFile(w.checkpointPath(clientId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("parse checkpoint of client %v failed: %v", clientId, err)
+	}
+	if c.Metrics == nil || c.Window == nil {
+		return nil, fmt.Errorf("checkpoint of client %v is incomplete", clientId)
+	}
+	return c, nil
+}
+
+// restore returns the metrics and measurement window of the checkpoint. The
+// time the client was down is left out by shifting their times to now.
+func (c *Checkpoint) restore(cfg MeasureConfig) (*ClientMetrics, *MeasurementWindow) {
+	gap := time.Since(c.Time)
+	metrics := c.Metrics
+	metrics.Start = metrics.Start.Add(gap)
+	if !metrics.End.IsZero() {
+		metrics.End = metrics.End.Add(gap)
+	}
+	return metrics, restoreMeasurementWindow(cfg, metrics, c.Window, gap)
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "CITUS_"
+
+// Backends a run can execute against.
+const (
+	BackendCitus  = "citus"
+	BackendMemory = "memory"
+)
+
+type Config struct {
+	// Backend is BackendCitus or BackendMemory. The memory backend is
+	// populated from the load section before the run starts.
+	Backend   string `yaml:"backend"`
+	TaskIndex int    `yaml:"task_index"`
+	// Routines is the number of workers. With CommandsFiles they pull the
+	// files from a queue, each file a client of its own.
+	Routines int      `yaml:"routines"`
+	Files    []string `yaml:"files"`
+	// Commands is CommandsFiles, or CommandsGenerate, commands generated per
+	// routine as shaped by the gen section.
+	Commands string `yaml:"commands"`
+	// Duration bounds a run by wall-clock time, looping the files or
+	// generating commands until it expires. Zero runs until the files, or
+	// gen.transactions generated commands, are exhausted.
+	Duration    time.Duration     `yaml:"duration"`
+	DB          DBConfig          `yaml:"db"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Measure     MeasureConfig     `yaml:"measure"`
+	Checkpoint  CheckpointConfig  `yaml:"checkpoint"`
+	Pacing      PacingConfig      `yaml:"pacing"`
+	Terminal    TerminalConfig    `yaml:"terminal"`
+	Compensator CompensatorConfig `yaml:"compensator"`
+	Retry       RetryConfig       `yaml:"retry"`
+	Load        LoaderConfig      `yaml:"load"`
+	DataGen     DataGenConfig     `yaml:"datagen"`
+	Gen         GenConfig         `yaml:"gen"`
+	Report      ReportConfig      `yaml:"report"`
+}
+
+type DBConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+	// Citus distributes the tables when the schema is created. Turn it off to
+	// run against a plain Postgres.
+	Citus bool `yaml:"citus"`
+}
+
+type MetricsConfig struct {
+	Dir string `yaml:"dir"`
+	// RunId names the directory the structured metrics of a run go to. It
+	// defaults to the start time of the run; processes of one run should be
+	// given the same id.
+	RunId string `yaml:"run_id"`
+	// Formats is a comma separated list of json, csv and legacy.
+	Formats string `yaml:"formats"`
+	// Interval is the sampling period of the per client time series; 0
+	// turns them off.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// MeasureConfig bounds the measurement window of every client. The
+// transactions of the warm-up and the cool-down are executed but left out of
+// the metrics; the time series still show them.
+type MeasureConfig struct {
+	// The warm-up lasts until both WarmupTime has passed and WarmupCount
+	// transactions were executed.
+	WarmupTime  time.Duration `yaml:"warmup_time"`
+	WarmupCount int           `yaml:"warmup_count"`
+	// The cool-down is the last CooldownTime of a client, and at least its
+	// last CooldownCount transactions.
+	CooldownTime  time.Duration `yaml:"cooldown_time"`
+	CooldownCount int           `yaml:"cooldown_count"`
+}
+
+// PacingConfig chooses between the closed loop and open-loop arrivals.
+type PacingConfig struct {
+	// Mode is closed, constant or poisson.
+	Mode string `yaml:"mode"`
+	// Rate is the target arrival rate of every client, in commands per
+	// second. Only the open-loop modes use it.
+	Rate float64 `yaml:"rate"`
+}
+
+// TerminalConfig holds the default keying and think times and per
+// transaction type overrides keyed by type code. Zero fields of an override
+// inherit the default. All zero, the default, runs at maximum throughput.
+type TerminalConfig struct {
+	TerminalTimes `yaml:",inline"`
+	PerType       map[string]TerminalTimes `yaml:"per_type"`
+}
+
+// Times returns the terminal times of the transaction type txnType.
+func (c *TerminalConfig) Times(txnType string) TerminalTimes {
+	if o, ok := c.PerType[txnType]; ok {
+		return c.TerminalTimes.override(o)
+	}
+	return c.TerminalTimes
+}
+
+// CheckpointConfig controls the progress checkpoints of the clients, kept in
+// <metrics.dir>/<run id>/checkpoint-<id>.json.
+type CheckpointConfig struct {
+	// Interval is the time between checkpoints of a client; 0 turns them off.
+	Interval time.Duration `yaml:"interval"`
+	// Resume continues the clients of metrics.run_id from their checkpoints.
+	Resume bool `yaml:"resume"`
+}
+
+type LoaderConfig struct {
+	DataDir  string `yaml:"data_dir"`
+	Truncate bool   `yaml:"truncate"`
+	// Generate loads the output of the data generator instead of DataDir.
+	Generate bool `yaml:"generate"`
+}
+
+// DataGenConfig sizes the synthetic initial database.
+type DataGenConfig struct {
+	Warehouses int   `yaml:"warehouses"`
+	Seed       int64 `yaml:"seed"`
+}
+
+// GenConfig shapes the transaction files written by "gen txn". The data set
+// size and seed come from DataGenConfig.
+type GenConfig struct {
+	OutDir       string `yaml:"out_dir"`
+	Clients      int    `yaml:"clients"`
+	Transactions int    `yaml:"transactions"`
+	// Mix holds relative weights per transaction type, e.g. "N=45,P=43,D=4".
+	Mix string `yaml:"mix"`
+	// Distributions are "uniform", "nurand[:A]" or "zipf[:S]".
+	WarehouseDist     string  `yaml:"warehouse_dist"`
+	CustomerDist      string  `yaml:"customer_dist"`
+	ItemDist          string  `yaml:"item_dist"`
+	MinLines          int     `yaml:"min_lines"`
+	MaxLines          int     `yaml:"max_lines"`
+	RemoteProbability float64 `yaml:"remote_probability"`
+}
+
+type ReportConfig struct {
+	// State also writes the final database state statistics.
+	State bool `yaml:"state"`
+}
+
+// CompensatorConfig controls the background routine that replays w_ytd and
+// d_ytd updates missed by Payment. Only one process of a run should enable it.
+type CompensatorConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Interval    time.Duration `yaml:"interval"`
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	Linger      time.Duration `yaml:"linger"`
+}
+
+// RetryConfig holds the default retry policy and per transaction type
+// overrides keyed by type code ("N", "P", ...). Zero fields of an override
+// inherit the default.
+type RetryConfig struct {
+	RetryPolicy `yaml:",inline"`
+	PerType     map[string]RetryPolicy `yaml:"per_type"`
+}
+
+// Policy returns the retry policy of the transaction type txnType.
+func (c *RetryConfig) Policy(txnType string) RetryPolicy {
+	if o, ok := c.PerType[txnType]; ok {
+		return c.RetryPolicy.override(o)
+	}
+	return c.RetryPolicy
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Backend:   BackendCitus,
+		TaskIndex: 0,
+		Routines:  5,
+		Commands:  CommandsFiles,
+		DB: DBConfig{
+			Host:    "localhost",
+			Port:    5115,
+			User:    "cs4224s",
+			Name:    "project",
+			SSLMode: "disable",
+			Citus:   true,
+		},
+		Metrics: MetricsConfig{
+			Dir:      "/home/stuproj/cs4224s",
+			Formats:  "json,csv",
+			Interval: 10 * time.Second,
+		},
+		Checkpoint: CheckpointConfig{
+			Interval: 30 * time.Second,
+		},
+		Pacing: PacingConfig{
+			Mode: PacingClosed,
+		},
+		Terminal: TerminalConfig{
+			TerminalTimes: TerminalTimes{ThinkDist: ThinkNegExp},
+		},
+		Compensator: CompensatorConfig{
+			Enabled:     false,
+			Interval:    10 * time.Second,
+			IdleTimeout: 5 * time.Minute,
+			Linger:      5 * time.Minute,
+		},
+		Retry: RetryConfig{
+			RetryPolicy: RetryPolicy{
+				Attempts:   RetryTimes,
+				BackoffMin: BackoffTimeMin * time.Millisecond,
+				BackoffMax: BackOffTimeMax * time.Millisecond,
+			},
+		},
+		DataGen: DataGenConfig{
+			Warehouses: 1,
+			Seed:       1,
+		},
+		Gen: GenConfig{
+			OutDir:            ".",
+			Clients:           20,
+			Transactions:      20000,
+			Mix:               "N=40,P=40,D=4,O=4,S=4,I=3,T=2,R=3",
+			WarehouseDist:     "uniform",
+			CustomerDist:      "nurand",
+			ItemDist:          "nurand",
+			MinLines:          MinOrderlines,
+			MaxLines:          MaxOrderlines,
+			RemoteProbability: 0.01,
+		},
+	}
+}
+
+// ValidateRun checks the fields only the run command depends on.
+func (c *Config) ValidateRun() error {
+	if c.Checkpoint.Resume && c.Metrics.RunId == "" {
+		return fmt.Errorf("invalid config: resume needs the run id of the run to resume")
+	}
+	if c.Commands == CommandsGenerate {
+		if _, err := NewTxnGenerator(&c.Gen, c.DataGen.Warehouses, c.DataGen.Seed); err != nil {
+			return fmt.Errorf("invalid config: %v", err)
+		}
+		return nil
+	}
+	if len(c.Files) == 0 {
+		return fmt.Errorf("invalid config: no transaction files")
+	}
+	// A looped file keeps its worker until the run ends.
+	if c.Duration > 0 && len(c.Files) > c.Routines {
+		return fmt.Errorf("invalid config: a run with a duration loops every file and needs a routine per file: %v routines but %v files", c.Routines, len(c.Files))
+	}
+	return nil
+}
+
+// Hash identifies the configuration a run used, so that metrics of runs can be
+// told apart. The password and the fields that differ between the processes
+// of one run (task index, files, run id, resume) are left out.
+func (c *Config) Hash() string {
+	cp := *c
+	cp.TaskIndex = 0
+	cp.Files = nil
+	cp.DB.Password = ""
+	cp.Metrics.RunId = ""
+	cp.Checkpoint.Resume = false
+	data, err := yaml.Marshal(&cp)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+func (c *DBConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%v sslmode=%s",
+		dsnQuote(c.Host), dsnQuote(c.User), dsnQuote(c.Password), dsnQuote(c.Name), c.Port, dsnQuote(c.SSLMode))
+}
+
+// dsnQuote quotes a value of a key=value connection string, so spaces, quotes
+// and backslashes in a password survive.
+func dsnQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// bindFlags registers every overridable config field on fs. Flag names double
+// as environment variable names: -db-host is CITUS_DB_HOST.
+func bindFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Backend, "backend", cfg.Backend, "store transactions run against: citus or memory")
+	fs.IntVar(&cfg.TaskIndex, "task-index", cfg.TaskIndex, "client id of the first file or routine of this process")
+	fs.IntVar(&cfg.Routines, "routines", cfg.Routines, "number of workers running the files, or of generating clients")
+	fs.StringVar(&cfg.DB.Host, "db-host", cfg.DB.Host, "database host")
+	fs.IntVar(&cfg.DB.Port, "db-port", cfg.DB.Port, "database port")
+	fs.StringVar(&cfg.DB.User, "db-user", cfg.DB.User, "database user")
+	fs.StringVar(&cfg.DB.Password, "db-password", cfg.DB.Password, "database password")
+	fs.StringVar(&cfg.DB.Name, "db-name", cfg.DB.Name, "database name")
+	fs.StringVar(&cfg.DB.SSLMode, "db-sslmode", cfg.DB.SSLMode, "database sslmode")
+	fs.BoolVar(&cfg.DB.Citus, "db-citus", cfg.DB.Citus, "distribute tables with Citus when creating the schema")
+	fs.StringVar(&cfg.Metrics.Dir, "metrics-dir", cfg.Metrics.Dir, "directory metrics files are written to")
+	fs.StringVar(&cfg.Metrics.RunId, "run-id", cfg.Metrics.RunId, "id of the run, shared by its processes; defaults to the start time")
+	fs.StringVar(&cfg.Metrics.Formats, "metrics-formats", cfg.Metrics.Formats, "metrics formats to write: json, csv and/or legacy")
+	fs.DurationVar(&cfg.Metrics.Interval, "metrics-interval", cfg.Metrics.Interval, "sampling period of the per client time series, 0 to disable")
+	fs.BoolVar(&cfg.Compensator.Enabled, "compensator", cfg.Compensator.Enabled, "run the payment compensator in this process")
+	fs.DurationVar(&cfg.Compensator.Interval, "compensator-interval", cfg.Compensator.Interval, "pause between compensator passes")
+	fs.DurationVar(&cfg.Compensator.IdleTimeout, "compensator-idle-timeout", cfg.Compensator.IdleTimeout, "compensator stops after this long without work")
+	fs.DurationVar(&cfg.Compensator.Linger, "compensator-linger", cfg.Compensator.Linger, "how long the compensator keeps running after all routines join")
+	fs.IntVar(&cfg.Retry.Attempts, "retry-attempts", cfg.Retry.Attempts, "attempts per unit of work of a transaction")
+	fs.DurationVar(&cfg.Retry.BackoffMin, "retry-backoff-min", cfg.Retry.BackoffMin, "sleep before the first retry, doubled on each further retry")
+	fs.DurationVar(&cfg.Retry.BackoffMax, "retry-backoff-max", cfg.Retry.BackoffMax, "cap of the sleep between attempts")
+}
+
+// bindMemoryFlags registers the data source of the memory backend.
+func bindMemoryFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Load.DataDir, "data-dir", cfg.Load.DataDir, "directory holding the data set CSV files")
+	fs.BoolVar(&cfg.Load.Generate, "generate", cfg.Load.Generate, "populate the memory backend with generated data")
+	bindDataGenFlags(fs, cfg)
+}
+
+func bindRunFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Commands, "commands", cfg.Commands, "where commands come from: files or generate")
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "stop the run after this long, looping the files if needed")
+	fs.DurationVar(&cfg.Measure.WarmupTime, "warmup-time", cfg.Measure.WarmupTime, "leave out the transactions of the first duration of every client")
+	fs.IntVar(&cfg.Measure.WarmupCount, "warmup-count", cfg.Measure.WarmupCount, "leave out the first transactions of every client")
+	fs.DurationVar(&cfg.Measure.CooldownTime, "cooldown-time", cfg.Measure.CooldownTime, "leave out the transactions of the last duration of every client")
+	fs.IntVar(&cfg.Measure.CooldownCount, "cooldown-count", cfg.Measure.CooldownCount, "leave out the last transactions of every client")
+	fs.DurationVar(&cfg.Checkpoint.Interval, "checkpoint-interval", cfg.Checkpoint.Interval, "time between progress checkpoints of every client, 0 to disable")
+	fs.BoolVar(&cfg.Checkpoint.Resume, "resume", cfg.Checkpoint.Resume, "resume the clients of -run-id from their checkpoints")
+	fs.StringVar(&cfg.Pacing.Mode, "pacing", cfg.Pacing.Mode, "closed, or constant or poisson open-loop arrivals")
+	fs.Float64Var(&cfg.Pacing.Rate, "rate", cfg.Pacing.Rate, "open-loop arrival rate of every client, in commands per second")
+	fs.DurationVar(&cfg.Terminal.Keying, "keying", cfg.Terminal.Keying, "keying time before every command")
+	fs.DurationVar(&cfg.Terminal.Think, "think", cfg.Terminal.Think, "think time, or its mean, after every command")
+	fs.StringVar(&cfg.Terminal.ThinkDist, "think-dist", cfg.Terminal.ThinkDist, "think time distribution: fixed or negexp")
+	bindMemoryFlags(fs, cfg)
+}
+
+func bindLoadFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Load.DataDir, "data-dir", cfg.Load.DataDir, "directory holding the data set CSV files")
+	fs.BoolVar(&cfg.Load.Truncate, "truncate", cfg.Load.Truncate, "empty the tables before loading")
+	fs.BoolVar(&cfg.Load.Generate, "generate", cfg.Load.Generate, "load generated data instead of the data directory")
+	bindDataGenFlags(fs, cfg)
+}
+
+// bindReportFlags also registers the data source of the memory backend, whose
+// state is the freshly populated data set.
+func bindReportFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.BoolVar(&cfg.Report.State, "state", cfg.Report.State, "also write the final database state statistics")
+	bindMemoryFlags(fs, cfg)
+}
+
+func bindDataGenFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.IntVar(&cfg.DataGen.Warehouses, "warehouses", cfg.DataGen.Warehouses, "number of warehouses to generate")
+	fs.Int64Var(&cfg.DataGen.Seed, "seed", cfg.DataGen.Seed, "seed of the generator")
+}
+
+func bindGenFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Gen.OutDir, "out", cfg.Gen.OutDir, "directory generated files are written to")
+	fs.IntVar(&cfg.Gen.Clients, "clients", cfg.Gen.Clients, "number of transaction files")
+	fs.IntVar(&cfg.Gen.Transactions, "transactions", cfg.Gen.Transactions, "transactions per file")
+	fs.StringVar(&cfg.Gen.Mix, "mix", cfg.Gen.Mix, "relative weight per transaction type")
+	fs.StringVar(&cfg.Gen.WarehouseDist, "warehouse-dist", cfg.Gen.WarehouseDist, "warehouse id distribution: uniform, nurand[:A] or zipf[:S]")
+	fs.StringVar(&cfg.Gen.CustomerDist, "customer-dist", cfg.Gen.CustomerDist, "customer id distribution")
+	fs.StringVar(&cfg.Gen.ItemDist, "item-dist", cfg.Gen.ItemDist, "item id distribution")
+	fs.IntVar(&cfg.Gen.MinLines, "min-lines", cfg.Gen.MinLines, "minimum order lines per NewOrder")
+	fs.IntVar(&cfg.Gen.MaxLines, "max-lines", cfg.Gen.MaxLines, "maximum order lines per NewOrder")
+	fs.Float64Var(&cfg.Gen.RemoteProbability, "remote-probability", cfg.Gen.RemoteProbability, "probability an order line is supplied by another warehouse")
+	bindDataGenFlags(fs, cfg)
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ParseConfig builds the configuration from, in increasing precedence, the
+// defaults, the YAML file given by -config (or CITUS_CONFIG), CITUS_*
+// environment variables and command line flags. bindExtra registers the flags
+// specific to one command and may be nil. The remaining positional arguments
+// are returned for the command to interpret.
+func ParseConfig(name string, args []string, bindExtra func(fs *flag.FlagSet, cfg *Config)) (*Config, []string, error) {
+	bind := func(fs *flag.FlagSet, cfg *Config) {
+		bindFlags(fs, cfg)
+		if bindExtra != nil {
+			bindExtra(fs, cfg)
+		}
+	}
+
+	// The first pass only finds the config file and which flags were given.
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a YAML config file")
+	bind(fs, DefaultConfig())
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := DefaultConfig()
+	if *configPath != "" {
+		if err := loadConfigFile(*configPath, cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The second pass replays env variables and then explicit flags onto the
+	// loaded config.
+	overrides := flag.NewFlagSet(name, flag.ContinueOnError)
+	bind(overrides, cfg)
+	var err error
+	overrides.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := overrides.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("invalid %s=%q: %v", envName(f.Name), v, setErr)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		if setErr := overrides.Set(f.Name, f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid -%s=%q: %v", f.Name, f.Value.String(), setErr)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func loadConfigFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config file failed: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parse config file %s failed: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid field at once so that a broken config can be
+// fixed in one go.
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	if c.Backend != BackendCitus && c.Backend != BackendMemory {
+		problems = append(problems, fmt.Sprintf("backend must be %s or %s, got %q", BackendCitus, BackendMemory, c.Backend))
+	}
+	if c.TaskIndex < 0 {
+		problems = append(problems, fmt.Sprintf("task_index must not be negative, got %v", c.TaskIndex))
+	}
+	if c.Routines <= 0 {
+		problems = append(problems, fmt.Sprintf("routines must be positive, got %v", c.Routines))
+	}
+	if c.Commands != CommandsFiles && c.Commands != CommandsGenerate {
+		problems = append(problems, fmt.Sprintf("commands must be %s or %s, got %q", CommandsFiles, CommandsGenerate, c.Commands))
+	}
+	if c.Checkpoint.Interval < 0 {
+		problems = append(problems, fmt.Sprintf("checkpoint.interval must not be negative, got %v", c.Checkpoint.Interval))
+	}
+	if c.Duration < 0 {
+		problems = append(problems, fmt.Sprintf("duration must not be negative, got %v", c.Duration))
+	}
+	if c.DB.Host == "" {
+		problems = append(problems, "db.host is empty")
+	}
+	if c.DB.Port <= 0 || c.DB.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("db.port out of range: %v", c.DB.Port))
+	}
+	if c.DB.User == "" {
+		problems = append(problems, "db.user is empty")
+	}
+	if c.DB.Name == "" {
+		problems = append(problems, "db.name is empty")
+	}
+	if c.Metrics.Dir == "" {
+		problems = append(problems, "metrics.dir is empty")
+	}
+	if strings.ContainsAny(c.Metrics.RunId, `/\`) || c.Metrics.RunId == "." || c.Metrics.RunId == ".." {
+		problems = append(problems, fmt.Sprintf("metrics.run_id must be a plain directory name, got %q", c.Metrics.RunId))
+	}
+	if c.Metrics.Interval < 0 {
+		problems = append(problems, fmt.Sprintf("metrics.interval must not be negative, got %v", c.Metrics.Interval))
+	}
+	if c.Measure.WarmupTime < 0 || c.Measure.WarmupCount < 0 || c.Measure.CooldownTime < 0 || c.Measure.CooldownCount < 0 {
+		problems = append(problems, fmt.Sprintf("measure: warm-up and cool-down must not be negative, got %+v", c.Measure))
+	}
+	if !contains(pacingModes, c.Pacing.Mode) {
+		problems = append(problems, fmt.Sprintf("pacing.mode must be one of %s, got %q", strings.Join(pacingModes, ", "), c.Pacing.Mode))
+	} else if c.Pacing.Mode != PacingClosed && c.Pacing.Rate <= 0 {
+		problems = append(problems, fmt.Sprintf("pacing.rate must be positive in %s mode, got %v", c.Pacing.Mode, c.Pacing.Rate))
+	}
+	terminal := false
+	for _, t := range TxnTypes {
+		times := c.Terminal.Times(t)
+		terminal = terminal || times.enabled()
+		if times.Keying < 0 || times.Think < 0 || (times.ThinkDist != ThinkFixed && times.ThinkDist != ThinkNegExp) {
+			problems = append(problems, fmt.Sprintf("terminal times of %s invalid: keying=%v think=%v think_dist=%q", t, times.Keying, times.Think, times.ThinkDist))
+		}
+	}
+	for _, t := range sortedKeys(c.Terminal.PerType) {
+		if !isTxnType(t) {
+			problems = append(problems, fmt.Sprintf("terminal.per_type: unknown transaction type %q", t))
+		}
+	}
+	if terminal && c.Pacing.Mode != PacingClosed {
+		problems = append(problems, fmt.Sprintf("keying and think times need the closed loop, got pacing.mode %s", c.Pacing.Mode))
+	}
+	formats := splitList(c.Metrics.Formats)
+	if len(formats) == 0 {
+		problems = append(problems, "metrics.formats is empty")
+	}
+	for _, f := range formats {
+		if !contains(metricsFormats, f) {
+			problems = append(problems, fmt.Sprintf("metrics.formats: unknown format %q, want one of %s", f, strings.Join(metricsFormats, ", ")))
+		}
+	}
+	if c.Compensator.Interval <= 0 {
+		problems = append(problems, fmt.Sprintf("compensator.interval must be positive, got %v", c.Compensator.Interval))
+	}
+	if c.Compensator.IdleTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("compensator.idle_timeout must be positive, got %v", c.Compensator.IdleTimeout))
+	}
+	if c.Compensator.Linger < 0 {
+		problems = append(problems, fmt.Sprintf("compensator.linger must not be negative, got %v", c.Compensator.Linger))
+	}
+	if c.DataGen.Warehouses <= 0 {
+		problems = append(problems, fmt.Sprintf("datagen.warehouses must be positive, got %v", c.DataGen.Warehouses))
+	}
+	if c.Gen.Clients <= 0 || c.Gen.Transactions <= 0 {
+		problems = append(problems, fmt.Sprintf("gen.clients and gen.transactions must be positive, got %v and %v", c.Gen.Clients, c.Gen.Transactions))
+	}
+	if c.Gen.MinLines <= 0 || c.Gen.MaxLines < c.Gen.MinLines || c.Gen.MaxLines > MaxNewOrderItems {
+		problems = append(problems, fmt.Sprintf("gen order line range invalid: min=%v max=%v", c.Gen.MinLines, c.Gen.MaxLines))
+	}
+	if c.Gen.RemoteProbability < 0 || c.Gen.RemoteProbability > 1 {
+		problems = append(problems, fmt.Sprintf("gen.remote_probability must be within [0, 1], got %v", c.Gen.RemoteProbability))
+	}
+	problems = append(problems, validateRetryPolicy("retry", c.Retry.RetryPolicy)...)
+	for _, t := range sortedKeys(c.Retry.PerType) {
+		if !isTxnType(t) {
+			problems = append(problems, fmt.Sprintf("retry.per_type: unknown transaction type %q", t))
+			continue
+		}
+		problems = append(problems, validateRetryPolicy("retry.per_type."+t, c.Retry.Policy(t))...)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validateRetryPolicy(name string, p RetryPolicy) []string {
+	problems := make([]string, 0)
+	if p.Attempts <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.attempts must be positive, got %v", name, p.Attempts))
+	}
+	if p.BackoffMin < 0 || p.BackoffMax < p.BackoffMin {
+		problems = append(problems, fmt.Sprintf("%s backoff range invalid: min=%v max=%v", name, p.BackoffMin, p.BackoffMax))
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
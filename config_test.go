@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestDBConfigDSN(t *testing.T) {
+	for _, password := range []string{"", "secret", "two words", `it's`, `back\slash`, `'\' = x`} {
+		c := &DBConfig{Host: "localhost", Port: 5433, User: "cs4224", Password: password, Name: "project", SSLMode: "disable"}
+		parsed, err := pgconn.ParseConfig(c.DSN())
+		if err != nil {
+			t.Errorf("password %q: parse %q failed: %v", password, c.DSN(), err)
+			continue
+		}
+		if parsed.Password != password || parsed.User != c.User || parsed.Database != c.Name || parsed.Host != c.Host || parsed.Port != uint16(c.Port) {
+			t.Errorf("password %q: parsed %q as %v@%v:%v/%v with password %q", password, c.DSN(), parsed.User, parsed.Host, parsed.Port, parsed.Database, parsed.Password)
+		}
+	}
+}
+
+func TestParseConfigPrecedence(t *testing.T) {
+	t.Setenv("CITUS_DB_HOST", "env-host")
+	t.Setenv("CITUS_DB_PORT", "6000")
+	cfg, args, err := ParseConfig("test", []string{"-db-port", "7000", "rest"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Host != "env-host" || cfg.DB.Port != 7000 || cfg.DB.User != DefaultConfig().DB.User {
+		t.Errorf("db %v@%v:%v, want the default user at env-host:7000", cfg.DB.User, cfg.DB.Host, cfg.DB.Port)
+	}
+	if len(args) != 1 || args[0] != "rest" {
+		t.Errorf("args %v, want [rest]", args)
+	}
+
+	t.Setenv("CITUS_DB_PORT", "port")
+	if _, _, err := ParseConfig("test", nil, nil); err == nil {
+		t.Errorf("invalid CITUS_DB_PORT accepted")
+	}
+}
+
+// lossyValue is a flag whose String does not parse back.
+type lossyValue struct{ set bool }
+
+func (v *lossyValue) String() string { return "<lossy>" }
+
+func (v *lossyValue) Set(s string) error {
+	if s == "<lossy>" {
+		return fmt.Errorf("cannot parse %q", s)
+	}
+	v.set = true
+	return nil
+}
+
+func TestParseConfigFlagNotReplayed(t *testing.T) {
+	bindLossy := func(fs *flag.FlagSet, cfg *Config) {
+		fs.Var(&lossyValue{}, "lossy", "")
+	}
+	if _, _, err := ParseConfig("test", []string{"-lossy", "x"}, bindLossy); err == nil || !strings.Contains(err.Error(), "-lossy") {
+		t.Errorf("dropped override returned %v, want an error naming -lossy", err)
+	}
+}
@@ -5,3 +5,16 @@ const (
 	BackoffTimeMin = 500
 	BackOffTimeMax = 1000
 )
+
+// Cardinalities fixed by the TPC-C population rules.
+const (
+	DistrictsPerWarehouse = 10
+	CustomersPerDistrict  = 3000
+	OrdersPerDistrict     = 3000
+	ItemCount             = 100000
+	// Orders from this id on are undelivered in the initial population.
+	FirstUndeliveredOrderId = 2101
+	MinOrderlines           = 5
+	MaxOrderlines           = 15
+	MaxCarrierId            = 10
+)
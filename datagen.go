@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var lastNameSyllables = []string{"BAR", "OUGHT", "ABLE", "PRI", "PRES", "ESE", "ANTI", "CALLY", "ATION", "EING"}
+
+const (
+	alphaNumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	originalMark = "ORIGINAL"
+)
+
+// DataGenerator produces the initial database of the TPC-C specification
+// (clause 4.3.3) as records in the format of the CS4224 data files, so its
+// output can be written out as CSV or fed to the Loader directly.
+//
+// Every file is generated from its own seeded random source, so reopening a
+// file yields the same records.
+type DataGenerator struct {
+	Warehouses int
+	Seed       int64
+
+	// cLast is the run-time constant C of NURand(255, 0, 999).
+	cLast int64
+	now   time.Time
+}
+
+func NewDataGenerator(warehouses int, seed int64) *DataGenerator {
+	return &DataGenerator{
+		Warehouses: warehouses,
+		Seed:       seed,
+		cLast:      rand.New(rand.NewSource(seed)).Int63n(256),
+		now:        time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// DataFileNames lists the files the generator and the loader know about.
+var DataFileNames = []string{WarehouseFile, DistrictFile, CustomerFile, OrderFile, OrderlineFile, ItemFile, StockFile}
+
+// Open implements RecordOpener.
+func (g *DataGenerator) Open(name string) (RecordSource, io.Closer, error) {
+	var next func(r *rand.Rand) []string
+	switch name {
+	case WarehouseFile:
+		next = g.warehouses()
+	case DistrictFile:
+		next = g.districts()
+	case CustomerFile:
+		next = g.customers()
+	case OrderFile:
+		next = g.orders()
+	case OrderlineFile:
+		next = g.orderlines()
+	case ItemFile:
+		next = g.items()
+	case StockFile:
+		next = g.stocks()
+	default:
+		return nil, nil, fmt.Errorf("no generator for %s", name)
+	}
+	seed := g.Seed
+	for _, c := range name {
+		seed = seed*31 + int64(c)
+	}
+	return &generatedRecords{rand: rand.New(rand.NewSource(seed)), next: next}, nil, nil
+}
+
+type generatedRecords struct {
+	rand *rand.Rand
+	next func(r *rand.Rand) []string
+}
+
+func (s *generatedRecords) Read() ([]string, error) {
+	rec := s.next(s.rand)
+	if rec == nil {
+		return nil, io.EOF
+	}
+	return rec, nil
+}
+
+// WriteCSV writes every data file into dir.
+func (g *DataGenerator) WriteCSV(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, name := range DataFileNames {
+		if err := g.writeFile(filepath.Join(dir, name), name); err != nil {
+			return fmt.Errorf("write %s failed: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (g *DataGenerator) writeFile(path string, name string) error {
+	records, _, err := g.Open(name)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	count := 0
+	for {
+		rec, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err := writer.Write(rec); err != nil {
+			return err
+		}
+		count++
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	logs.Printf("generated %v records into %s", count, path)
+	return nil
+}
+
+func (g *DataGenerator) items() func(r *rand.Rand) []string {
+	iid := 0
+	return func(r *rand.Rand) []string {
+		iid++
+		if iid > ItemCount {
+			return nil
+		}
+		return []string{itoa(iid), randString(r, 14, 24), formatMoney(randFloat(r, 1, 100)), itoa(randInt(r, 1, 10000)), randData(r)}
+	}
+}
+
+func (g *DataGenerator) warehouses() func(r *rand.Rand) []string {
+	wid := 0
+	return func(r *rand.Rand) []string {
+		wid++
+		if wid > g.Warehouses {
+			return nil
+		}
+		rec := []string{itoa(wid), randString(r, 6, 10)}
+		rec = append(rec, randAddress(r)...)
+		return append(rec, formatTax(randFloat(r, 0, 0.2)), "300000.00")
+	}
+}
+
+func (g *DataGenerator) districts() func(r *rand.Rand) []string {
+	wid, did := 1, 0
+	return func(r *rand.Rand) []string {
+		did++
+		if did > DistrictsPerWarehouse {
+			wid, did = wid+1, 1
+		}
+		if wid > g.Warehouses {
+			return nil
+		}
+		rec := []string{itoa(wid), itoa(did), randString(r, 6, 10)}
+		rec = append(rec, randAddress(r)...)
+		return append(rec, formatTax(randFloat(r, 0, 0.2)), "30000.00", itoa(OrdersPerDistrict+1))
+	}
+}
+
+func (g *DataGenerator) customers() func(r *rand.Rand) []string {
+	wid, did, cid := 1, 1, 0
+	return func(r *rand.Rand) []string {
+		cid++
+		if cid > CustomersPerDistrict {
+			did, cid = did+1, 1
+		}
+		if did > DistrictsPerWarehouse {
+			wid, did = wid+1, 1
+		}
+		if wid > g.Warehouses {
+			return nil
+		}
+
+		lastNameNum := cid - 1
+		if cid > 1000 {
+			lastNameNum = int(NURand(r, 255, 0, 999, g.cLast))
+		}
+		credit := "GC"
+		if r.Intn(10) == 0 {
+			credit = "BC"
+		}
+		rec := []string{itoa(wid), itoa(did), itoa(cid), randString(r, 8, 16), "OE", LastName(lastNameNum)}
+		rec = append(rec, randAddress(r)...)
+		return append(rec, randNumString(r, 16), formatTime(g.now), credit, "50000.00", formatTax(randFloat(r, 0, 0.5)),
+			"-10.00", "10.00", "1", "0", randString(r, 300, 500))
+	}
+}
+
+// orderCustomers returns the random permutation of customer ids assigned to
+// the orders of one district, indexed by o_id-1.
+func (g *DataGenerator) orderCustomers(wid, did int) []int {
+	r := rand.New(rand.NewSource(g.Seed ^ int64(wid)<<20 ^ int64(did)<<8))
+	perm := r.Perm(CustomersPerDistrict)
+	for i := range perm {
+		perm[i]++
+	}
+	return perm
+}
+
+// orderlineCounts returns o_ol_cnt of every order of one district, indexed
+// by o_id-1. Both the order and the order line files derive it from here.
+func (g *DataGenerator) orderlineCounts(wid, did int) []int {
+	r := rand.New(rand.NewSource(g.Seed ^ int64(wid)<<20 ^ int64(did)<<8 ^ 1))
+	counts := make([]int, OrdersPerDistrict)
+	for i := range counts {
+		counts[i] = randInt(r, MinOrderlines, MaxOrderlines)
+	}
+	return counts
+}
+
+func (g *DataGenerator) orders() func(r *rand.Rand) []string {
+	wid, did, oid := 1, 1, 0
+	cids := g.orderCustomers(wid, did)
+	counts := g.orderlineCounts(wid, did)
+	return func(r *rand.Rand) []string {
+		oid++
+		if oid > OrdersPerDistrict {
+			did, oid = did+1, 1
+			if did > DistrictsPerWarehouse {
+				wid, did = wid+1, 1
+			}
+			if wid > g.Warehouses {
+				return nil
+			}
+			cids = g.orderCustomers(wid, did)
+			counts = g.orderlineCounts(wid, did)
+		}
+		if wid > g.Warehouses {
+			return nil
+		}
+
+		carrierId := "null"
+		if oid < FirstUndeliveredOrderId {
+			carrierId = itoa(randInt(r, 1, MaxCarrierId))
+		}
+		return []string{itoa(wid), itoa(did), itoa(oid), itoa(cids[oid-1]), carrierId, itoa(counts[oid-1]), "1", formatTime(g.now)}
+	}
+}
+
+func (g *DataGenerator) orderlines() func(r *rand.Rand) []string {
+	wid, did, oid, number := 1, 1, 1, 0
+	counts := g.orderlineCounts(wid, did)
+	return func(r *rand.Rand) []string {
+		number++
+		if number > counts[oid-1] {
+			oid, number = oid+1, 1
+		}
+		if oid > OrdersPerDistrict {
+			did, oid = did+1, 1
+			if did > DistrictsPerWarehouse {
+				wid, did = wid+1, 1
+			}
+			if wid > g.Warehouses {
+				return nil
+			}
+			counts = g.orderlineCounts(wid, did)
+		}
+		if wid > g.Warehouses {
+			return nil
+		}
+
+		deliveryDate, amount := formatTime(g.now), "0.00"
+		if oid >= FirstUndeliveredOrderId {
+			deliveryDate, amount = "null", formatMoney(randFloat(r, 0.01, 9999.99))
+		}
+		return []string{itoa(wid), itoa(did), itoa(oid), itoa(number), itoa(randInt(r, 1, ItemCount)),
+			deliveryDate, amount, itoa(wid), "5", randString(r, 24, 24)}
+	}
+}
+
+func (g *DataGenerator) stocks() func(r *rand.Rand) []string {
+	wid, iid := 1, 0
+	return func(r *rand.Rand) []string {
+		iid++
+		if iid > ItemCount {
+			wid, iid = wid+1, 1
+		}
+		if wid > g.Warehouses {
+			return nil
+		}
+		rec := []string{itoa(wid), itoa(iid), itoa(randInt(r, 10, 100)), "0.00", "0", "0"}
+		for d := 0; d < DistrictsPerWarehouse; d++ {
+			rec = append(rec, randString(r, 24, 24))
+		}
+		return append(rec, randData(r))
+	}
+}
+
+// NURand is the non-uniform random function of TPC-C clause 2.1.6.
+func NURand(r *rand.Rand, a, x, y, c int64) int64 {
+	return (((r.Int63n(a+1) | (x + r.Int63n(y-x+1))) + c) % (y - x + 1)) + x
+}
+
+// LastName builds a customer last name from the three digits of num
+// (TPC-C clause 4.3.2.3).
+func LastName(num int) string {
+	return lastNameSyllables[num/100] + lastNameSyllables[(num/10)%10] + lastNameSyllables[num%10]
+}
+
+func randInt(r *rand.Rand, min, max int) int {
+	return min + r.Intn(max-min+1)
+}
+
+func randFloat(r *rand.Rand, min, max float64) float64 {
+	return min + r.Float64()*(max-min)
+}
+
+func randString(r *rand.Rand, minLen, maxLen int) string {
+	b := make([]byte, randInt(r, minLen, maxLen))
+	for i := range b {
+		b[i] = alphaNumeric[r.Intn(len(alphaNumeric))]
+	}
+	return string(b)
+}
+
+func randNumString(r *rand.Rand, length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = byte('0' + r.Intn(10))
+	}
+	return string(b)
+}
+
+// randData returns i_data/s_data: 26 to 50 characters, 10% of which contain
+// "ORIGINAL" at a random position.
+func randData(r *rand.Rand) string {
+	s := randString(r, 26, 50)
+	if r.Intn(10) != 0 {
+		return s
+	}
+	pos := r.Intn(len(s) - len(originalMark) + 1)
+	return s[:pos] + originalMark + s[pos+len(originalMark):]
+}
+
+// randAddress returns street 1, street 2, city, state and zip.
+func randAddress(r *rand.Rand) []string {
+	state := string([]byte{byte('A' + r.Intn(26)), byte('A' + r.Intn(26))})
+	return []string{randString(r, 10, 20), randString(r, 10, 20), randString(r, 10, 20), state, randNumString(r, 4) + "11111"}
+}
+
+func itoa(i int) string {
+	return strconv.Itoa(i)
+}
+
+func formatMoney(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+func formatTax(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(dataTimeLayout + ".000")
+}
+
+// genCommand dispatches "gen data" and "gen txn".
+func genCommand(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing what to generate: data or txn")
+	}
+	if len(args) > 1 {
+		// Flags after the generator name are not parsed, so fail loudly
+		// instead of silently generating with the defaults.
+		return fmt.Errorf("unexpected arguments %v: flags go before %q", args[1:], args[0])
+	}
+	switch args[0] {
+	case "data":
+		g := NewDataGenerator(cfg.DataGen.Warehouses, cfg.DataGen.Seed)
+		return g.WriteCSV(cfg.Gen.OutDir)
+	case "txn":
+		g, err := NewTxnGenerator(&cfg.Gen, cfg.DataGen.Warehouses, cfg.DataGen.Seed)
+		if err != nil {
+			return err
+		}
+		return g.WriteFiles(cfg.Gen.OutDir)
+	default:
+		return fmt.Errorf("unknown generator %q", args[0])
+	}
+}
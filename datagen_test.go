@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readGenerated calls fn with every record the generator yields for name.
+func readGenerated(t *testing.T, g *DataGenerator, name string, fn func(rec []string)) int {
+	t.Helper()
+	records, _, err := g.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	n := 0
+	for {
+		rec, err := records.Read()
+		if err == io.EOF {
+			return n
+		}
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		fn(rec)
+		n++
+	}
+}
+
+func atoi(t *testing.T, s string) int {
+	t.Helper()
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatalf("invalid integer %q", s)
+	}
+	return v
+}
+
+// checkShare fails unless between 8% and 12% of n records are marked.
+func checkShare(t *testing.T, what string, marked, n int) {
+	t.Helper()
+	if share := float64(marked) / float64(n); share < 0.08 || share > 0.12 {
+		t.Errorf("%v of %v %s (%.1f%%), want about 10%%", marked, n, what, share*100)
+	}
+}
+
+func TestDataGeneratorPopulation(t *testing.T) {
+	g := NewDataGenerator(1, 1)
+
+	if n := readGenerated(t, g, WarehouseFile, func([]string) {}); n != 1 {
+		t.Errorf("%v warehouses, want 1", n)
+	}
+	if n := readGenerated(t, g, DistrictFile, func(rec []string) {
+		if rec[10] != strconv.Itoa(OrdersPerDistrict+1) {
+			t.Errorf("district %v: d_next_o_id %v, want %v", rec[1], rec[10], OrdersPerDistrict+1)
+		}
+	}); n != DistrictsPerWarehouse {
+		t.Errorf("%v districts, want %v", n, DistrictsPerWarehouse)
+	}
+
+	original := 0
+	n := readGenerated(t, g, ItemFile, func(rec []string) {
+		if strings.Contains(rec[4], originalMark) {
+			original++
+		}
+	})
+	if n != ItemCount {
+		t.Errorf("%v items, want %v", n, ItemCount)
+	}
+	checkShare(t, "items with ORIGINAL data", original, n)
+
+	original = 0
+	n = readGenerated(t, g, StockFile, func(rec []string) {
+		if strings.Contains(rec[16], originalMark) {
+			original++
+		}
+	})
+	if n != ItemCount {
+		t.Errorf("%v stocks, want %v", n, ItemCount)
+	}
+	checkShare(t, "stocks with ORIGINAL data", original, n)
+
+	lastNames := make(map[string]bool, 1000)
+	for i := 0; i < 1000; i++ {
+		lastNames[LastName(i)] = true
+	}
+	badCredit, nonSequential := 0, 0
+	n = readGenerated(t, g, CustomerFile, func(rec []string) {
+		cid := atoi(t, rec[2])
+		if rec[13] == "BC" {
+			badCredit++
+		}
+		switch {
+		case cid <= 1000 && rec[5] != LastName(cid-1):
+			t.Errorf("customer %v/%v: c_last %v, want %v", rec[1], cid, rec[5], LastName(cid-1))
+		case cid > 1000 && !lastNames[rec[5]]:
+			t.Errorf("customer %v/%v: c_last %v is not built from three syllables", rec[1], cid, rec[5])
+		case cid > 1000 && rec[5] != LastName((cid-1)%1000):
+			nonSequential++
+		}
+	})
+	if n != DistrictsPerWarehouse*CustomersPerDistrict {
+		t.Errorf("%v customers, want %v", n, DistrictsPerWarehouse*CustomersPerDistrict)
+	}
+	checkShare(t, "customers with BC credit", badCredit, n)
+	if nonSequential < DistrictsPerWarehouse*(CustomersPerDistrict-1000)*9/10 {
+		t.Errorf("only %v customers above c_id 1000 have a random last name", nonSequential)
+	}
+
+	type districtOrder struct{ did, oid int }
+	olCnts := make(map[districtOrder]int, DistrictsPerWarehouse*OrdersPerDistrict)
+	customerOrders := make(map[[2]int]int, DistrictsPerWarehouse*CustomersPerDistrict)
+	n = readGenerated(t, g, OrderFile, func(rec []string) {
+		k := districtOrder{atoi(t, rec[1]), atoi(t, rec[2])}
+		olCnt := atoi(t, rec[5])
+		if olCnt < MinOrderlines || olCnt > MaxOrderlines {
+			t.Errorf("order %v: o_ol_cnt %v out of [%v, %v]", k, olCnt, MinOrderlines, MaxOrderlines)
+		}
+		if delivered := rec[4] != "null"; delivered != (k.oid < FirstUndeliveredOrderId) {
+			t.Errorf("order %v: o_carrier_id %v", k, rec[4])
+		}
+		olCnts[k] = olCnt
+		customerOrders[[2]int{k.did, atoi(t, rec[3])}]++
+	})
+	if n != DistrictsPerWarehouse*OrdersPerDistrict {
+		t.Errorf("%v orders, want %v", n, DistrictsPerWarehouse*OrdersPerDistrict)
+	}
+	// Every customer places exactly one of the initial orders.
+	if len(customerOrders) != DistrictsPerWarehouse*CustomersPerDistrict {
+		t.Errorf("%v customers with orders, want %v", len(customerOrders), DistrictsPerWarehouse*CustomersPerDistrict)
+	}
+
+	lines := make(map[districtOrder]int, len(olCnts))
+	readGenerated(t, g, OrderlineFile, func(rec []string) {
+		k := districtOrder{atoi(t, rec[1]), atoi(t, rec[2])}
+		lines[k]++
+		if number := atoi(t, rec[3]); number != lines[k] {
+			t.Errorf("order %v: ol_number %v, want %v", k, number, lines[k])
+		}
+		if undelivered := rec[5] == "null"; undelivered != (k.oid >= FirstUndeliveredOrderId) {
+			t.Errorf("order %v: ol_delivery_d %v", k, rec[5])
+		}
+	})
+	if !reflect.DeepEqual(lines, olCnts) {
+		t.Errorf("order lines per order do not match o_ol_cnt")
+	}
+}
+
+func TestDataGeneratorDeterministic(t *testing.T) {
+	g := NewDataGenerator(1, 7)
+	same := NewDataGenerator(1, 7)
+	same.now = g.now
+	other := NewDataGenerator(1, 8)
+	other.now = g.now
+
+	for _, name := range []string{CustomerFile, OrderFile} {
+		var want, reopened, got, differ [][]string
+		readGenerated(t, g, name, func(rec []string) { want = append(want, rec) })
+		readGenerated(t, g, name, func(rec []string) { reopened = append(reopened, rec) })
+		readGenerated(t, same, name, func(rec []string) { got = append(got, rec) })
+		readGenerated(t, other, name, func(rec []string) { differ = append(differ, rec) })
+		if !reflect.DeepEqual(reopened, want) {
+			t.Errorf("%s: reopening yields different records", name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the same seed yields different records", name)
+		}
+		if reflect.DeepEqual(differ, want) {
+			t.Errorf("%s: another seed yields the same records", name)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+)
+
+var (
+	memoryStoreOnce sync.Once
+	memoryStore     *MemoryStore
+	memoryStoreErr  error
+)
+
+// loadedMemoryStore returns a memory store populated with one generated
+// warehouse, shared by the handler tests. Each test works on its own
+// district, so they do not depend on the order they run in.
+func loadedMemoryStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("populating the memory store takes seconds")
+	}
+	memoryStoreOnce.Do(func() {
+		memoryStore = NewMemoryStore()
+		memoryStoreErr = NewLoader(NewDataGenerator(1, 1).Open, memoryStore).Load(context.Background())
+	})
+	if memoryStoreErr != nil {
+		t.Fatalf("populate memory store failed: %v", memoryStoreErr)
+	}
+	return memoryStore
+}
+
+// runHandler runs cmd the way execute does.
+func runHandler(ctx context.Context, store Store, cmd TxnCommand) Outcome {
+	logs := log.New(io.Discard, "", 0)
+	retry := NewRetrier(DefaultConfig().Retry.Policy(cmd.Type()))
+	switch c := cmd.(type) {
+	case *NewOrderCmd:
+		return NewOrder(ctx, logs, store, retry, c)
+	case *PaymentCmd:
+		return Payment(ctx, logs, store, retry, c)
+	case *DeliveryCmd:
+		return Delivery(ctx, logs, store, retry, c)
+	case *OrderStatusCmd:
+		return OrderStatus(ctx, logs, store, retry, c)
+	case *StockLevelCmd:
+		return StockLevel(ctx, logs, store, retry, c)
+	case *PopularItemCmd:
+		return PopularItem(ctx, logs, store, retry, c)
+	case *TopBalanceCmd:
+		return TopBalance(ctx, logs, store, retry, c)
+	case *RelatedCustomerCmd:
+		return RelatedCustomer(ctx, logs, store, retry, c)
+	}
+	panic("unknown command type " + cmd.Type())
+}
+
+func TestHandlers(t *testing.T) {
+	store := loadedMemoryStore(t)
+	ctx := context.Background()
+
+	nextOrderId := func(t *testing.T, wid, did int64) int64 {
+		t.Helper()
+		oid, err := store.GetNextOrderId(ctx, wid, did)
+		if err != nil {
+			t.Fatalf("get next_o_id of %v/%v failed: %v", wid, did, err)
+		}
+		return oid
+	}
+	balance := func(t *testing.T, wid, did, cid int64) float64 {
+		t.Helper()
+		cp, err := store.GetCustomerParam(ctx, wid, did, cid)
+		if err != nil {
+			t.Fatalf("get customer %v/%v/%v failed: %v", wid, did, cid, err)
+		}
+		return cp.CBalance
+	}
+
+	tests := []struct {
+		name string
+		cmd  TxnCommand
+		want Outcome
+		// before runs ahead of the command and returns the check of its
+		// effect, if any.
+		before func(t *testing.T) func(t *testing.T)
+	}{
+		{
+			name: "new order",
+			cmd: &NewOrderCmd{Wid: 1, Did: 1, Cid: 7, Items: []*NewOrderItem{
+				{ItemId: 1, SupplyWid: 1, Quantity: 5},
+				{ItemId: 2, SupplyWid: 1, Quantity: 3},
+			}},
+			want: OutcomeCommitted,
+			before: func(t *testing.T) func(t *testing.T) {
+				oid := nextOrderId(t, 1, 1)
+				return func(t *testing.T) {
+					if got := nextOrderId(t, 1, 1); got != oid+1 {
+						t.Errorf("next_o_id %v, want %v", got, oid+1)
+					}
+					_, o, lines, err := store.GetLastOrder(ctx, 1, 1, 7)
+					if err != nil {
+						t.Fatalf("get last order failed: %v", err)
+					}
+					if o.OId != oid || len(lines) != 2 {
+						t.Errorf("last order %v with %v lines, want %v with 2", o.OId, len(lines), oid)
+					}
+				}
+			},
+		},
+		{
+			name: "new order of a missing district",
+			cmd:  &NewOrderCmd{Wid: 2, Did: 1, Cid: 1, Items: []*NewOrderItem{{ItemId: 1, SupplyWid: 2, Quantity: 1}}},
+			want: OutcomeInvalid,
+		},
+		{
+			// The order id is spent before the stock is found missing.
+			name: "new order from a missing supply warehouse",
+			cmd:  &NewOrderCmd{Wid: 1, Did: 10, Cid: 1, Items: []*NewOrderItem{{ItemId: 1, SupplyWid: 2, Quantity: 1}}},
+			want: OutcomePartial,
+		},
+		{
+			name: "payment",
+			cmd:  &PaymentCmd{Wid: 1, Did: 2, Cid: 7, Amount: 100},
+			want: OutcomeCommitted,
+			before: func(t *testing.T) func(t *testing.T) {
+				b := balance(t, 1, 2, 7)
+				return func(t *testing.T) {
+					if got := balance(t, 1, 2, 7); got != b-100 {
+						t.Errorf("c_balance %v, want %v", got, b-100)
+					}
+				}
+			},
+		},
+		{
+			name: "payment of a missing customer",
+			cmd:  &PaymentCmd{Wid: 1, Did: 2, Cid: CustomersPerDistrict + 1, Amount: 100},
+			want: OutcomeInvalid,
+		},
+		{
+			name: "delivery",
+			cmd:  &DeliveryCmd{Wid: 1, CarrierId: 3},
+			want: OutcomeCommitted,
+		},
+		{
+			name: "order status",
+			cmd:  &OrderStatusCmd{Wid: 1, Did: 3, Cid: 7},
+			want: OutcomeCommitted,
+		},
+		{
+			name: "order status of a missing customer",
+			cmd:  &OrderStatusCmd{Wid: 1, Did: 3, Cid: CustomersPerDistrict + 1},
+			want: OutcomeInvalid,
+		},
+		{
+			name: "stock level",
+			cmd:  &StockLevelCmd{Wid: 1, Did: 4, Threshold: 20, L: 10},
+			want: OutcomeCommitted,
+		},
+		{
+			name: "popular item",
+			cmd:  &PopularItemCmd{Wid: 1, Did: 5, L: 10},
+			want: OutcomeCommitted,
+		},
+		{
+			name: "top balance",
+			cmd:  &TopBalanceCmd{},
+			want: OutcomeCommitted,
+		},
+		{
+			name: "related customer",
+			cmd:  &RelatedCustomerCmd{Wid: 1, Did: 6, Cid: 7},
+			want: OutcomeCommitted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var check func(t *testing.T)
+			if tt.before != nil {
+				check = tt.before(t)
+			}
+			if got := runHandler(ctx, store, tt.cmd); got != tt.want {
+				t.Fatalf("outcome %v, want %v", got, tt.want)
+			}
+			if check != nil {
+				check(t)
+			}
+		})
+	}
+
+	// The committed transactions keep the district consistent; district 10
+	// has the gap of the partial NewOrder.
+	states, err := store.GetDistrictStates(ctx)
+	if err != nil {
+		t.Fatalf("get district states failed: %v", err)
+	}
+	for _, ds := range states {
+		if ds.Did != 10 && ds.NextOId-1 != ds.MaxOId {
+			t.Errorf("district %v/%v: d_next_o_id - 1 = %v, max(o_id) = %v", ds.Wid, ds.Did, ds.NextOId-1, ds.MaxOId)
+		}
+		if ds.OlCnt.Count > 0 || ds.Delivery.Count > 0 || ds.Balance.Count > 0 {
+			t.Errorf("district %v/%v: ol_cnt, delivery and balance violations %v, %v and %v", ds.Wid, ds.Did, ds.OlCnt.Count, ds.Delivery.Count, ds.Balance.Count)
+		}
+	}
+}
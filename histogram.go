@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histSubBits sets the resolution of Histogram: values below 2^histSubBits µs
+// are counted exactly, larger ones in buckets 2^(histSubBits-1) per power of
+// two wide, i.e. within 1/64 (1.6%) of the recorded value.
+const histSubBits = 7
+
+const (
+	histSubCount = 1 << histSubBits
+	histHalf     = histSubCount / 2
+)
+
+// Histogram is a log-linear latency histogram in microseconds, in the spirit
+// of HdrHistogram: constant relative error, fixed memory per power of two and
+// exact merging, so histograms of different routines and processes can be
+// added up before taking percentiles.
+type Histogram struct {
+	counts []int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func histIndex(v int64) int {
+	if v < histSubCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBits
+	return histSubCount + (shift-1)*histHalf + int(v>>shift) - histHalf
+}
+
+// histLower returns the smallest value counted in bucket i.
+func histLower(i int) int64 {
+	if i < histSubCount {
+		return int64(i)
+	}
+	shift := (i-histSubCount)/histHalf + 1
+	sub := int64((i-histSubCount)%histHalf + histHalf)
+	return sub << shift
+}
+
+// histUpper returns the largest value counted in bucket i.
+func histUpper(i int) int64 {
+	return histLower(i+1) - 1
+}
+
+// Record adds a latency, truncated to the microsecond.
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordValue(d.Microseconds())
+}
+
+// RecordValue adds a value in microseconds. Negative values count as 0.
+func (h *Histogram) RecordValue(v int64) {
+	h.recordCount(v, 1)
+}
+
+func (h *Histogram) recordCount(v int64, n int64) {
+	if v < 0 {
+		v = 0
+	}
+	i := histIndex(v)
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i] += n
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count += n
+	h.sum += v * n
+}
+
+// Merge adds the values of o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		counts := make([]int64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if h.count == 0 || o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.sum += o.sum
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Min and Max are exact.
+func (h *Histogram) Min() int64 {
+	return h.min
+}
+
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+// Mean is exact.
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return float64(h.sum) / float64(h.count)
+}
+
+// Percentile returns the value at or below which p percent of the values lie,
+// reported as the upper bound of its bucket and clamped to [Min, Max].
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			v := histUpper(i)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// histogramJSON is the sparse encoding of a Histogram: Buckets holds
+// [lowest value, count] pairs of the non-empty buckets.
+type histogramJSON struct {
+	SubBits int        `json:"sub_bits"`
+	Count   int64      `json:"count"`
+	Sum     int64      `json:"sum_us"`
+	Min     int64      `json:"min_us"`
+	Max     int64      `json:"max_us"`
+	Buckets [][2]int64 `json:"buckets"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	hj := histogramJSON{SubBits: histSubBits, Count: h.count, Sum: h.sum, Min: h.min, Max: h.max, Buckets: make([][2]int64, 0)}
+	for i, n := range h.counts {
+		if n > 0 {
+			hj.Buckets = append(hj.Buckets, [2]int64{histLower(i), n})
+		}
+	}
+	return json.Marshal(&hj)
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var hj histogramJSON
+	if err := json.Unmarshal(data, &hj); err != nil {
+		return err
+	}
+	if hj.SubBits != histSubBits {
+		return fmt.Errorf("histogram resolution %v bits, want %v", hj.SubBits, histSubBits)
+	}
+	*h = Histogram{}
+	for _, b := range hj.Buckets {
+		if b[1] > 0 {
+			h.recordCount(b[0], b[1])
+		}
+	}
+	// The bucket lower bounds lose the exact extremes and sum.
+	if h.count != hj.Count {
+		return fmt.Errorf("histogram count %v does not match its buckets (%v)", hj.Count, h.count)
+	}
+	h.sum, h.min, h.max = hj.Sum, hj.Min, hj.Max
+	return nil
+}
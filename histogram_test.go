@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHistogramBucketBounds(t *testing.T) {
+	for i := 0; i < histSubCount+20*histHalf; i++ {
+		lower, upper := histLower(i), histUpper(i)
+		if histIndex(lower) != i || histIndex(upper) != i {
+			t.Fatalf("bucket %v: [%v, %v] maps to buckets %v and %v", i, lower, upper, histIndex(lower), histIndex(upper))
+		}
+		if histIndex(upper+1) != i+1 {
+			t.Fatalf("bucket %v: %v maps to bucket %v, want %v", i, upper+1, histIndex(upper+1), i+1)
+		}
+		if i < histSubCount && lower != upper {
+			t.Fatalf("bucket %v below %v is [%v, %v], want exact", i, histSubCount, lower, upper)
+		}
+		if width := upper - lower + 1; float64(width) > float64(lower)/histHalf+1 {
+			t.Fatalf("bucket %v: [%v, %v] wider than 1/%v of its values", i, lower, upper, histHalf)
+		}
+	}
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		p      float64
+		want   int64
+	}{
+		{"empty", nil, 50, 0},
+		{"single", []int64{42}, 99, 42},
+		{"exact below sub count", []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 50, 5},
+		{"p100 is max", []int64{1, 5, 1000}, 100, 1000},
+		{"p0 is min", []int64{7, 5, 1000}, 0, 5},
+		// 1000 lies in bucket [992, 1007]; the upper bound is clamped to max.
+		{"clamped to max", []int64{1000, 1000}, 50, 1000},
+		{"bucket upper bound", []int64{1000, 2000}, 50, 1007},
+		{"negative counts as zero", []int64{-5, 3}, 50, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistogram()
+			for _, v := range tt.values {
+				h.RecordValue(v)
+			}
+			if got := h.Percentile(tt.p); got != tt.want {
+				t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramPercentileError(t *testing.T) {
+	h := NewHistogram()
+	for v := int64(1); v <= 100000; v++ {
+		h.RecordValue(v)
+	}
+	for _, p := range []float64{50, 90, 95, 99, 99.9} {
+		want := int64(p / 100 * 100000)
+		got := h.Percentile(p)
+		if got < want || float64(got-want) > float64(want)/histHalf {
+			t.Errorf("Percentile(%v) = %v, want %v within 1/%v", p, got, want, histHalf)
+		}
+	}
+	if h.Mean() != 50000.5 {
+		t.Errorf("Mean() = %v, want 50000.5", h.Mean())
+	}
+}
+
+func TestHistogramMergeAndJSON(t *testing.T) {
+	a, b, all := NewHistogram(), NewHistogram(), NewHistogram()
+	for i := int64(0); i < 1000; i++ {
+		a.Record(time.Duration(i*i) * time.Microsecond)
+		b.RecordValue(i * 3)
+		all.RecordValue(i * i)
+		all.RecordValue(i * 3)
+	}
+	a.Merge(b)
+	a.Merge(NewHistogram())
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewHistogram()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []*Histogram{a, decoded} {
+		if h.Count() != all.Count() || h.Min() != all.Min() || h.Max() != all.Max() || h.Mean() != all.Mean() {
+			t.Errorf("count %v min %v max %v mean %v, want %v %v %v %v", h.Count(), h.Min(), h.Max(), h.Mean(), all.Count(), all.Min(), all.Max(), all.Mean())
+		}
+		for _, p := range []float64{1, 50, 90, 99, 99.9} {
+			if h.Percentile(p) != all.Percentile(p) {
+				t.Errorf("Percentile(%v) = %v, want %v", p, h.Percentile(p), all.Percentile(p))
+			}
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// File names of the CS4224 data set. None of the files has a header row.
+const (
+	WarehouseFile = "warehouse.csv"
+	DistrictFile  = "district.csv"
+	CustomerFile  = "customer.csv"
+	OrderFile     = "order.csv"
+	OrderlineFile = "order-line.csv"
+	ItemFile      = "item.csv"
+	StockFile     = "stock.csv"
+)
+
+const dataTimeLayout = "2006-01-02 15:04:05"
+
+// RecordSource yields the records of one data file. *csv.Reader satisfies it.
+type RecordSource interface {
+	Read() ([]string, error)
+}
+
+// RecordOpener opens a fresh RecordSource over the named data file. The
+// loader reads a file once per table it feeds.
+type RecordOpener func(name string) (RecordSource, io.Closer, error)
+
+// TableSink receives the rows of one table at a time.
+type TableSink interface {
+	CopyRows(ctx context.Context, table string, columns []string, rows pgx.CopyFromSource) (int64, error)
+}
+
+type copyTarget struct {
+	Table   string
+	Columns []string
+	// Row maps one record of the data file to a row of Table.
+	Row func(p *recordParser) []interface{}
+}
+
+type dataFile struct {
+	Name    string
+	Columns int
+	Targets []*copyTarget
+}
+
+type districtKey struct {
+	Wid int64
+	Did int64
+}
+
+type customerKey struct {
+	Wid int64
+	Did int64
+	Cid int64
+}
+
+// Loader fans the records of the data set out into the split tables. Some
+// tables need values from other files (warehouse columns in district_info,
+// item names in order_lines), so the files are read in the order of
+// dataFiles and those values are remembered on the way.
+type Loader struct {
+	open RecordOpener
+	sink TableSink
+
+	loadedAt         time.Time
+	warehouses       map[int64][]string
+	itemNames        map[int64]string
+	lastOrderIds     map[customerKey]int64
+	firstUndelivered map[districtKey]int64
+}
+
+func NewLoader(open RecordOpener, sink TableSink) *Loader {
+	return &Loader{
+		open:             open,
+		sink:             sink,
+		loadedAt:         time.Now().UTC(),
+		warehouses:       make(map[int64][]string, 0),
+		itemNames:        make(map[int64]string, 0),
+		lastOrderIds:     make(map[customerKey]int64, 0),
+		firstUndelivered: make(map[districtKey]int64, 0),
+	}
+}
+
+func (l *Loader) dataFiles() []*dataFile {
+	return []*dataFile{
+		{
+			Name:    ItemFile,
+			Columns: 5,
+			Targets: []*copyTarget{
+				{
+					Table:   "items",
+					Columns: []string{"i_id", "i_name", "i_price", "i_im_id", "i_data"},
+					Row: func(p *recordParser) []interface{} {
+						l.itemNames[p.Int(0)] = p.Str(1)
+						return []interface{}{p.Int(0), p.Str(1), p.Float(2), p.Int(3), p.Str(4)}
+					},
+				},
+			},
+		},
+		{
+			Name:    WarehouseFile,
+			Columns: 9,
+			Targets: []*copyTarget{
+				{
+					Table:   "warehouse_param",
+					Columns: []string{"w_id", "w_ytd"},
+					Row: func(p *recordParser) []interface{} {
+						l.warehouses[p.Int(0)] = p.rec
+						return []interface{}{p.Int(0), p.Float(8)}
+					},
+				},
+			},
+		},
+		{
+			Name:    OrderFile,
+			Columns: 8,
+			Targets: []*copyTarget{
+				{
+					Table:   "orders",
+					Columns: []string{"o_w_id", "o_d_id", "o_id", "o_c_id", "o_carrier_id", "o_ol_cnt", "o_all_local", "o_entry_d"},
+					Row: func(p *recordParser) []interface{} {
+						wid, did, oid, cid := p.Int(0), p.Int(1), p.Int(2), p.Int(3)
+						carrierId := p.NullableInt(4)
+
+						ck := customerKey{Wid: wid, Did: did, Cid: cid}
+						if oid > l.lastOrderIds[ck] {
+							l.lastOrderIds[ck] = oid
+						}
+						dk := districtKey{Wid: wid, Did: did}
+						if first, ok := l.firstUndelivered[dk]; carrierId == nil && (!ok || oid < first) {
+							l.firstUndelivered[dk] = oid
+						}
+						return []interface{}{wid, did, oid, cid, carrierId, p.Int(5), p.Bool(6), p.Time(7)}
+					},
+				},
+			},
+		},
+		{
+			Name:    DistrictFile,
+			Columns: 11,
+			Targets: []*copyTarget{
+				{
+					Table: "district_info",
+					Columns: []string{"d_w_id", "d_id", "w_name", "w_street_1", "w_street_2", "w_city", "w_state", "w_zip", "w_tax",
+						"d_name", "d_street_1", "d_street_2", "d_city", "d_state", "d_zip", "d_tax"},
+					Row: func(p *recordParser) []interface{} {
+						w, ok := l.warehouses[p.Int(0)]
+						if !ok {
+							p.Fail(fmt.Errorf("district references unknown warehouse %v", p.Int(0)))
+							return nil
+						}
+						wp := &recordParser{rec: w}
+						return []interface{}{p.Int(0), p.Int(1), wp.Str(1), wp.Str(2), wp.Str(3), wp.Str(4), wp.Str(5), wp.Str(6), wp.Float(7),
+							p.Str(2), p.Str(3), p.Str(4), p.Str(5), p.Str(6), p.Str(7), p.Float(8)}
+					},
+				},
+				{
+					Table:   "district_order_id",
+					Columns: []string{"d_w_id", "d_id", "d_next_o_id"},
+					Row: func(p *recordParser) []interface{} {
+						return []interface{}{p.Int(0), p.Int(1), p.Int(10)}
+					},
+				},
+				{
+					Table:   "district_param",
+					Columns: []string{"d_w_id", "d_id", "d_ytd"},
+					Row: func(p *recordParser) []interface{} {
+						return []interface{}{p.Int(0), p.Int(1), p.Float(9)}
+					},
+				},
+				{
+					Table:   "delivery_cursor",
+					Columns: []string{"w_id", "d_id", "next_delivery_o_id"},
+					Row: func(p *recordParser) []interface{} {
+						next, ok := l.firstUndelivered[districtKey{Wid: p.Int(0), Did: p.Int(1)}]
+						if !ok {
+							next = p.Int(10)
+						}
+						return []interface{}{p.Int(0), p.Int(1), next}
+					},
+				},
+				{
+					Table:   "payment_pointer",
+					Columns: []string{"w_id", "d_id", "pointer"},
+					Row: func(p *recordParser) []interface{} {
+						return []interface{}{p.Int(0), p.Int(1), l.loadedAt}
+					},
+				},
+			},
+		},
+		{
+			Name:    CustomerFile,
+			Columns: 21,
+			Targets: []*copyTarget{
+				{
+					Table: "customer_info",
+					Columns: []string{"c_w_id", "c_d_id", "c_id", "c_first", "c_middle", "c_last", "c_street_1", "c_street_2",
+						"c_city", "c_state", "c_zip", "c_phone", "c_since", "c_credit", "c_credit_lim", "c_discount", "c_data"},
+					Row: func(p *recordParser) []interface{} {
+						return []interface{}{p.Int(0), p.Int(1), p.Int(2), p.Str(3), p.Str(4), p.Str(5), p.Str(6), p.Str(7),
+							p.Str(8), p.Str(9), p.Str(10), p.Str(11), p.Time(12), p.Str(13), p.Float(14), p.Float(15), p.Str(20)}
+					},
+				},
+				{
+					Table:   "customer_param",
+					Columns: []string{"c_w_id", "c_d_id", "c_id", "c_balance", "c_ytd_payment", "c_payment_cnt", "c_delivery_cnt", "c_last_o_id"},
+					Row: func(p *recordParser) []interface{} {
+						lastOrderId := l.lastOrderIds[customerKey{Wid: p.Int(0), Did: p.Int(1), Cid: p.Int(2)}]
+						return []interface{}{p.Int(0), p.Int(1), p.Int(2), p.Float(16), p.Float(17), p.Int(18), p.Int(19), lastOrderId}
+					},
+				},
+			},
+		},
+		{
+			Name:    OrderlineFile,
+			Columns: 10,
+			Targets: []*copyTarget{
+				{
+					Table: "order_lines",
+					Columns: []string{"ol_w_id", "ol_d_id", "ol_o_id", "ol_number", "ol_i_id", "ol_i_name",
+						"ol_delivery_d", "ol_amount", "ol_supply_w_id", "ol_quantity", "ol_dist_info"},
+					Row: func(p *recordParser) []interface{} {
+						name, ok := l.itemNames[p.Int(4)]
+						if !ok {
+							p.Fail(fmt.Errorf("order line references unknown item %v", p.Int(4)))
+							return nil
+						}
+						return []interface{}{p.Int(0), p.Int(1), p.Int(2), p.Int(3), p.Int(4), name,
+							p.Time(5), p.Float(6), p.Int(7), p.Int(8), p.Str(9)}
+					},
+				},
+			},
+		},
+		{
+			Name:    StockFile,
+			Columns: 17,
+			Targets: []*copyTarget{
+				{
+					Table:   "stocks",
+					Columns: []string{"s_w_id", "s_i_id", "s_qty", "s_ytd", "s_order_cnt", "s_remote_cnt"},
+					Row: func(p *recordParser) []interface{} {
+						return []interface{}{p.Int(0), p.Int(1), p.Int(2), p.Float(3), p.Int(4), p.Int(5)}
+					},
+				},
+				{
+					Table: "stock_info_by_district",
+					Columns: []string{"s_w_id", "s_i_id", "s_dist_01", "s_dist_02", "s_dist_03", "s_dist_04", "s_dist_05",
+						"s_dist_06", "s_dist_07", "s_dist_08", "s_dist_09", "s_dist_10", "s_data"},
+					Row: func(p *recordParser) []interface{} {
+						return []interface{}{p.Int(0), p.Int(1), p.Str(6), p.Str(7), p.Str(8), p.Str(9), p.Str(10),
+							p.Str(11), p.Str(12), p.Str(13), p.Str(14), p.Str(15), p.Str(16)}
+					},
+				},
+			},
+		},
+	}
+}
+
+// LoadedTables lists every table the loader writes.
+func LoadedTables() []string {
+	tables := make([]string, 0)
+	for _, f := range NewLoader(nil, nil).dataFiles() {
+		for _, t := range f.Targets {
+			tables = append(tables, t.Table)
+		}
+	}
+	return tables
+}
+
+func (l *Loader) Load(ctx context.Context) error {
+	for _, f := range l.dataFiles() {
+		for _, t := range f.Targets {
+			start := time.Now()
+			n, err := l.copy(ctx, f, t)
+			if err != nil {
+				return fmt.Errorf("load %s into %s failed: %v", f.Name, t.Table, err)
+			}
+			logs.Printf("loaded %v rows from %s into %s in %v", n, f.Name, t.Table, time.Since(start).Round(time.Millisecond))
+		}
+	}
+	return nil
+}
+
+func (l *Loader) copy(ctx context.Context, f *dataFile, t *copyTarget) (int64, error) {
+	records, closer, err := l.open(f.Name)
+	if err != nil {
+		return 0, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	src := &recordCopySource{
+		file:    f.Name,
+		columns: f.Columns,
+		records: records,
+		row:     t.Row,
+	}
+	n, err := l.sink.CopyRows(ctx, t.Table, t.Columns, src)
+	if err == nil {
+		err = src.Err()
+	}
+	return n, err
+}
+
+// recordCopySource adapts a RecordSource to pgx.CopyFromSource.
+type recordCopySource struct {
+	file    string
+	columns int
+	records RecordSource
+	row     func(p *recordParser) []interface{}
+
+	lineCount int
+	values    []interface{}
+	err       error
+}
+
+func (s *recordCopySource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	rec, err := s.records.Read()
+	if err == io.EOF {
+		return false
+	} else if err != nil {
+		s.err = fmt.Errorf("read %s failed: %v", s.file, err)
+		return false
+	}
+	s.lineCount++
+
+	if len(rec) != s.columns {
+		s.err = fmt.Errorf("%s line %v: expected %v fields, got %v", s.file, s.lineCount, s.columns, len(rec))
+		return false
+	}
+	p := &recordParser{rec: rec}
+	s.values = s.row(p)
+	if p.err != nil {
+		s.err = fmt.Errorf("%s line %v: %v", s.file, s.lineCount, p.err)
+		return false
+	}
+	return true
+}
+
+func (s *recordCopySource) Values() ([]interface{}, error) {
+	return s.values, nil
+}
+
+func (s *recordCopySource) Err() error {
+	return s.err
+}
+
+// recordParser converts the fields of one record, remembering the first
+// conversion error instead of returning it from every call.
+type recordParser struct {
+	rec []string
+	err error
+}
+
+func (p *recordParser) Fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func isNullField(s string) bool {
+	return s == "" || strings.EqualFold(s, "null")
+}
+
+func (p *recordParser) Str(i int) string {
+	return p.rec[i]
+}
+
+// Int also accepts integral decimals such as "10.0", which some files use for
+// quantities.
+func (p *recordParser) Int(i int) int64 {
+	s := strings.TrimSpace(p.rec[i])
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != float64(int64(f)) {
+		p.Fail(fmt.Errorf("field %v: invalid integer %q", i+1, p.rec[i]))
+		return 0
+	}
+	return int64(f)
+}
+
+func (p *recordParser) NullableInt(i int) interface{} {
+	if isNullField(p.rec[i]) {
+		return nil
+	}
+	return p.Int(i)
+}
+
+func (p *recordParser) Float(i int) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(p.rec[i]), 64)
+	if err != nil {
+		p.Fail(fmt.Errorf("field %v: invalid number %q", i+1, p.rec[i]))
+	}
+	return v
+}
+
+func (p *recordParser) Bool(i int) bool {
+	return p.Int(i) != 0
+}
+
+// Time returns nil for null fields so it can be copied into nullable columns.
+func (p *recordParser) Time(i int) interface{} {
+	if isNullField(p.rec[i]) {
+		return nil
+	}
+	t, err := time.Parse(dataTimeLayout, strings.TrimSpace(p.rec[i]))
+	if err != nil {
+		p.Fail(fmt.Errorf("field %v: invalid timestamp %q", i+1, p.rec[i]))
+		return nil
+	}
+	return t
+}
+
+// CSVOpener opens the data files in dir.
+func CSVOpener(dir string) RecordOpener {
+	return func(name string) (RecordSource, io.Closer, error) {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = false
+		return reader, file, nil
+	}
+}
+
+// PostgresSink copies rows with COPY FROM over the connection pool behind db.
+type PostgresSink struct {
+	db *gorm.DB
+}
+
+func NewPostgresSink(db *gorm.DB) *PostgresSink {
+	return &PostgresSink{db: db}
+}
+
+func (s *PostgresSink) CopyRows(ctx context.Context, table string, columns []string, rows pgx.CopyFromSource) (int64, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var n int64
+	err = conn.Raw(func(driverConn interface{}) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		n, err = pgxConn.CopyFrom(ctx, pgx.Identifier{table}, columns, rows)
+		return err
+	})
+	return n, err
+}
+
+func (s *PostgresSink) Truncate(tables []string) error {
+	return s.db.Exec(fmt.Sprintf("TRUNCATE %s", strings.Join(tables, ", "))).Error
+}
+
+// dataOpener picks the data source of the load configuration: the generator
+// if load.generate is set, the CSV files in dataDir otherwise.
+func dataOpener(cfg *Config, dataDir string) (RecordOpener, error) {
+	if cfg.Load.Generate {
+		logs.Printf("loading generated data: warehouses=%v, seed=%v", cfg.DataGen.Warehouses, cfg.DataGen.Seed)
+		return NewDataGenerator(cfg.DataGen.Warehouses, cfg.DataGen.Seed).Open, nil
+	}
+	if dataDir == "" {
+		return nil, fmt.Errorf("no data directory: pass it as an argument, set load.data_dir or use -generate")
+	}
+	return CSVOpener(dataDir), nil
+}
+
+func loadCommand(cfg *Config, args []string) error {
+	dataDir := cfg.Load.DataDir
+	if len(args) > 0 {
+		dataDir = args[0]
+	}
+	open, err := dataOpener(cfg, dataDir)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDB(&cfg.DB)
+	if err != nil {
+		return err
+	}
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+
+	sink := NewPostgresSink(db)
+	if cfg.Load.Truncate {
+		if err := sink.Truncate(LoadedTables()); err != nil {
+			return fmt.Errorf("truncate tables failed: %v", err)
+		}
+	}
+
+	start := time.Now()
+	if err := NewLoader(open, sink).Load(context.Background()); err != nil {
+		return err
+	}
+	logs.Printf("load finished in %v", time.Since(start).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDataSet is a hand-written data set of one district with distinct
+// values in every column, so a swapped column index shows in the tables.
+var testDataSet = map[string]string{
+	ItemFile: `1,Apple,1.5,11,apple data
+2,Pear,2.25,12,pear data`,
+	WarehouseFile: `1,W One,W Street 1,W Street 2,W City,WS,W-ZIP,0.125,3000.5`,
+	DistrictFile:  `1,1,D One,D Street 1,D Street 2,D City,DS,D-ZIP,0.0625,300.25,4`,
+	CustomerFile: `1,1,1,Ann,OE,BARBAR,C Street 1,C Street 2,C City,CS,C-ZIP,555-0101,2022-10-01 08:00:00,GC,50000,0.25,-10.5,20.75,3,2,ann data
+1,1,2,Bob,OF,OUGHTABLE,C Street 3,C Street 4,C Town,CT,C-ZIP2,555-0102,2022-10-01 09:00:00,BC,40000,0.375,-30.5,40.25,5,4,bob data`,
+	// Order 1 is delivered, so deliveries continue at order 2.
+	OrderFile: `1,1,1,1,7,1,1,2022-10-01 10:00:00
+1,1,2,2,null,1,0,2022-10-01 11:00:00
+1,1,3,1,,1,1,2022-10-01 12:00:00`,
+	OrderlineFile: `1,1,1,1,2,2022-10-02 10:00:00,4.5,1,3,dist info 1
+1,1,2,1,1,null,6,2,4,dist info 2
+1,1,3,1,2,,9,1,5,dist info 3`,
+	StockFile: `1,1,91,2,3,4,d01,d02,d03,d04,d05,d06,d07,d08,d09,d10,s data
+1,2,92,5,6,7,e01,e02,e03,e04,e05,e06,e07,e08,e09,e10,s data`,
+}
+
+func testDataOpener(files map[string]string) RecordOpener {
+	return func(name string) (RecordSource, io.Closer, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		reader := csv.NewReader(strings.NewReader(data))
+		reader.FieldsPerRecord = -1
+		return reader, nil, nil
+	}
+}
+
+func TestLoaderSplitTables(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := NewLoader(testDataOpener(testDataSet), store).Load(ctx); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.Parse(dataTimeLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	check := func(name string, got, want interface{}, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+
+	di, err := store.GetDistrictInfo(ctx, 1, 1)
+	check("district_info", di, &DistrictInfo{
+		DId: 1, DWId: 1,
+		WName: "W One", WStreet1: "W Street 1", WStreet2: "W Street 2", WCity: "W City", WState: "WS", WZip: "W-ZIP", WTax: 0.125,
+		DName: "D One", DStreet1: "D Street 1", DStreet2: "D Street 2", DCity: "D City", DState: "DS", DZip: "D-ZIP", DTax: 0.0625,
+	}, err)
+	oid, err := store.GetNextOrderId(ctx, 1, 1)
+	check("d_next_o_id", oid, int64(4), err)
+	cursor, err := store.GetDeliveryCursor(ctx, 1, 1)
+	check("next_delivery_o_id", cursor, int64(2), err)
+	ytds, err := store.GetWarehouseYtds(ctx)
+	check("w_ytd", ytds, map[int64]float64{1: 3000.5}, err)
+	states, err := store.GetDistrictStates(ctx)
+	if err == nil && len(states) == 1 {
+		check("d_ytd", states[0].DYtd, 300.25, nil)
+	} else {
+		t.Errorf("district states: %v, %v", states, err)
+	}
+
+	ci, err := store.GetCustomerInfo(ctx, 1, 1, 2)
+	check("customer_info", ci, &CustomerInfo{
+		CWId: 1, CDId: 1, CId: 2, CFirst: "Bob", CMiddle: "OF", CLast: "OUGHTABLE",
+		CStreet1: "C Street 3", CStreet2: "C Street 4", CCity: "C Town", CState: "CT", CZip: "C-ZIP2", CPhone: "555-0102",
+		CSince: at("2022-10-01 09:00:00"), CCredit: "BC", CCreditLim: 40000, CDiscount: 0.375, CData: "bob data",
+	}, err)
+	// c_last_o_id is the last order of the customer in order.csv.
+	for cid, last := range map[int64]int64{1: 3, 2: 2} {
+		cp, err := store.GetCustomerParam(ctx, 1, 1, cid)
+		if err != nil {
+			t.Fatalf("customer_param %v: %v", cid, err)
+		}
+		check("c_last_o_id", cp.CLastOId, last, nil)
+	}
+	cp, err := store.GetCustomerParam(ctx, 1, 1, 1)
+	check("customer_param", cp, &CustomerParam{
+		CWId: 1, CDId: 1, CId: 1, CBalance: -10.5, CYtdPayment: 20.75, CPaymentCnt: 3, CDeliveryCnt: 2, CLastOId: 3,
+	}, err)
+
+	o, err := store.GetOrder(ctx, 1, 1, 1)
+	check("orders", o, &Order{OWId: 1, ODId: 1, OId: 1, OCId: 1, OCarrierId: 7, OOlCnt: 1, OAllLocal: true, OEntryD: at("2022-10-01 10:00:00")}, err)
+	o, err = store.GetOrder(ctx, 1, 1, 2)
+	check("undelivered orders", o, &Order{OWId: 1, ODId: 1, OId: 2, OCId: 2, OCarrierId: -1, OOlCnt: 1, OEntryD: at("2022-10-01 11:00:00")}, err)
+	lines, err := store.GetOrderlines(ctx, 1, 1, 1)
+	check("order_lines", lines, []*Orderline{{
+		OlWId: 1, OlDId: 1, OlOId: 1, OlNumber: 1, OlIId: 2, OlIName: "Pear", OlDeliveryD: at("2022-10-02 10:00:00"),
+		OlAmount: 4.5, OlSupplyWId: 1, OlQuantity: 3, OlDistInfo: "dist info 1",
+	}}, err)
+
+	stock, err := store.GetStock(ctx, 1, 2)
+	check("stocks", stock, &Stock{SWId: 1, SIId: 2, SQty: 92, SYtd: 5, SOrderCnt: 6, SRemoteCnt: 7}, err)
+	for did, want := range map[int64]string{1: "e01", 5: "e05", 10: "e10"} {
+		info, err := store.GetStockDistInfo(ctx, 1, 2, did)
+		check("stock_info_by_district", info, want, err)
+	}
+	item, err := store.GetItem(ctx, 1)
+	check("items", item, &Item{IId: 1, IName: "Apple", IPrice: 1.5}, err)
+}
+
+func TestLoaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		err  string
+	}{
+		{"wrong field count", DistrictFile, "1,1,D One", "load district.csv into district_info failed: district.csv line 1: expected 11 fields, got 3"},
+		{"invalid integer", StockFile, strings.Replace(testDataSet[StockFile], "92", "9x", 1), "stock.csv line 2: field 3: invalid integer \"9x\""},
+		{"unknown warehouse", DistrictFile, "2" + testDataSet[DistrictFile][1:], "district references unknown warehouse 2"},
+		{"unknown item", OrderlineFile, "1,1,1,1,3,,1,1,1,x", "order line references unknown item 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, len(testDataSet))
+			for name, data := range testDataSet {
+				files[name] = data
+			}
+			files[tt.file] = tt.data
+			err := NewLoader(testDataOpener(files), NewMemoryStore()).Load(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("load returned %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
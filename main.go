@@ -1,171 +1,118 @@
 package main
 
 import (
-	"bufio"
-	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"runtime"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
 
-	"github.com/montanaflynn/stats"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var (
-	logs          *log.Logger = log.New(os.Stdout, "", 0)
-	routineNumber int         = 5
-)
+var logs *log.Logger = log.New(os.Stdout, "", 0)
 
-func main() {
-	args := os.Args
+type Command struct {
+	Name    string
+	Summary string
+	// Flags registers the command's own flags on top of the shared ones.
+	Flags func(fs *flag.FlagSet, cfg *Config)
+	Run   func(cfg *Config, args []string) error
+}
 
-	if len(args) < 4+routineNumber {
-		logs.Printf("not enough arguments: args=%+v", args)
-		return
-	}
-	logs.Printf("main starting. Arguments: %+v, NumOfCPU:%v", args, runtime.NumCPU())
+var commands = []*Command{
+	{
+		Name:    "run",
+		Summary: "execute transaction files against the database",
+		Flags:   bindRunFlags,
+		Run:     runCommand,
+	},
+	{
+		Name:    "validate",
+		Summary: "parse transaction files offline and report their contents",
+		Run:     validateCommand,
+	},
+	{
+		Name:    "schema",
+		Summary: "create, recreate, drop or inspect the database schema",
+		Run:     schemaCommand,
+	},
+	{
+		Name:    "load",
+		Summary: "bulk-load the initial data set",
+		Flags:   bindLoadFlags,
+		Run:     loadCommand,
+	},
+	{
+		Name:    "check",
+		Summary: "check the TPC-C consistency conditions",
+		Flags:   bindMemoryFlags,
+		Run:     checkCommand,
+	},
+	{
+		Name:    "report",
+		Summary: "aggregate the client metrics and final database state of a run",
+		Flags:   bindReportFlags,
+		Run:     reportCommand,
+	},
+	{
+		Name:    "gen",
+		Summary: "generate the data set (gen data) or transaction files (gen txn)",
+		Flags:   bindGenFlags,
+		Run:     genCommand,
+	},
+}
 
-	taskIndexStr := os.Args[2]
-	taskIndex, err := strconv.ParseInt(taskIndexStr, 10, 64)
-	if err != nil {
-		logs.Printf("convert task index failed: %v", err)
-		return
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
-	ip := os.Args[3]
-	filePaths := os.Args[4:]
 
-	// TODO
-	dsn := fmt.Sprintf("host=%s user=cs4224s password= dbname=project port=5115 sslmode=disable", ip)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		// Logger: logger.Default.LogMode(logger.Info),
-	})
-	if err != nil {
-		logs.Printf("open postgres client failed: %v", err)
-		return
+	var cmd *Command
+	for _, c := range commands {
+		if c.Name == os.Args[1] {
+			cmd = c
+			break
+		}
 	}
-
-	var wg sync.WaitGroup
-	for i := 0; i < routineNumber; i++ {
-		wg.Add(1)
-
-		routineIndex := i + int(taskIndex)
-		j := i
-
-		logs.Printf("starting routine #%v", routineIndex)
-		go func() {
-			defer wg.Done()
-			execute(routineIndex, db, filePaths[j])
-		}()
+	if cmd == nil {
+		if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "-help" {
+			logs.Printf("unknown command %q", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
 	}
 
-	isCompensate := taskIndex == 15
-	ctx, cancelFunc := context.WithCancel(context.Background())
-	if isCompensate {
-		go func() {
-			Compensate(ctx, db)
-		}()
+	cfg, args, err := ParseConfig(os.Args[0]+" "+cmd.Name, os.Args[2:], cmd.Flags)
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		logs.Printf("load config failed: %v", err)
+		os.Exit(2)
 	}
 
-	wg.Wait()
-
-	if isCompensate {
-		timer := time.NewTimer(5 * time.Minute)
-		<-timer.C
-		cancelFunc()
+	if err := cmd.Run(cfg, args); err != nil {
+		logs.Printf("%s failed: %v", cmd.Name, err)
+		os.Exit(1)
 	}
-
-	time.Sleep(10 * time.Second)
-
-	logs.Printf("all routines joined. main exits normally")
 }
 
-func execute(routineIndex int, db *gorm.DB, filePath string) {
-	logs := log.New(os.Stdout, fmt.Sprintf("[routine #%v] ", routineIndex), 0)
-	logs.Printf("starts. filePath=%s", filePath)
-
-	defer func() {
-		if err := recover(); err != nil {
-			logs.Printf("recover from panic. Error: \n%v", err)
-		} else {
-			logs.Printf("exits normally")
-		}
-	}()
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		logs.Printf("open file failed: %v", err)
-		return
+func usage() {
+	logs.Printf("usage: %s <command> [-config file] [flags] [args...]\n\ncommands:", os.Args[0])
+	for _, c := range commands {
+		logs.Printf("  %-8s %s", c.Name, c.Summary)
 	}
-	defer file.Close()
-
-	lineCount := 0
-	scanner := bufio.NewScanner(file)
-
-	// metrics
-	var counter int64 = 0
-	latencies := make([]float64, 0)
-	routineStart := time.Now()
-
-	for scanner.Scan() {
-		start := time.Now()
-
-		lineCount++
-		cmd := scanner.Text()
-		words := strings.Split(cmd, ",")
-		if len(words) == 0 {
-			logs.Printf("cmd is empty at line %v", lineCount)
-			return
-		}
-
-		var err error
-		switch words[0] {
-		case "N":
-			err = NewOrder(logs, db, words, scanner, &lineCount)
-		case "P":
-			err = Payment(logs, db, words, scanner, &lineCount)
-		case "D":
-			err = Delivery(logs, db, words, scanner, &lineCount)
-		case "O":
-			err = OrderStatus(logs, db, words, scanner, &lineCount)
-		case "S":
-			err = StockLevel(logs, db, words, scanner, &lineCount)
-		case "I":
-			err = PopularItem(logs, db, words, scanner, &lineCount)
-		case "T":
-			err = TopBalance(logs, db, words, scanner, &lineCount)
-		case "R":
-			err = RelatedCustomer(logs, db, words, scanner, &lineCount)
-		}
-
-		if err != nil {
-			logs.Printf("execute command failed: %v. file at %s line %v", err, filePath, lineCount)
-			continue
-		}
-
-		end := time.Now()
-		latency := end.Sub(start)
-		latencies = append(latencies, float64(latency.Milliseconds()))
-		counter++
-	}
-
-	routineEnd := time.Now()
-	totalLatency := routineEnd.Sub(routineStart).Seconds()
-	throughPut := float64(counter) / totalLatency
-	avgLatency, _ := stats.Mean(latencies)
-	medianLatency, _ := stats.Median(latencies)
-	nintyFivePercentile, _ := stats.Percentile(latencies, 95.0)
-	nintyNinePercentile, _ := stats.Percentile(latencies, 99.0)
+}
 
-	metricsFile, err := os.OpenFile(fmt.Sprintf("/home/stuproj/cs4224s/%v_metrics.txt", routineIndex), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0777)
+// OpenDB is the connection setup shared by every command that talks to the
+// database.
+func OpenDB(cfg *DBConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
+		// Logger: logger.Default.LogMode(logger.Info),
+	})
 	if err != nil {
-		logs.Printf("open metrics file failed: %v", err)
-		return
+		return nil, fmt.Errorf("open postgres client failed: %v", err)
 	}
-	metricsFile.Write([]byte(fmt.Sprintf("%v %v %.2f %.2f %.2f %.2f %.2f", counter, totalLatency, throughPut, avgLatency, medianLatency, nintyFivePercentile, nintyNinePercentile)))
+	return db, nil
 }
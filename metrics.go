@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metrics output formats, listed in metrics.formats.
+const (
+	MetricsJSON   = "json"
+	MetricsCSV    = "csv"
+	MetricsLegacy = "legacy"
+)
+
+var metricsFormats = []string{MetricsJSON, MetricsCSV, MetricsLegacy}
+
+// TypeMetrics counts the transactions of one type by outcome, with the
+// latencies of the committed ones.
+type TypeMetrics struct {
+	Outcomes [len(outcomeNames)]int64
+	Retries  int64
+	Latency  *Histogram
+}
+
+// ClientMetrics accumulates what one client executed between Start and End.
+// Throughput and latency only cover committed transactions. Malformed counts
+// the commands whose transaction type could not be told; the others are
+// invalid outcomes of their type. Warmup and Cooldown count the transactions
+// executed outside of the measurement window. Incomplete is set when the run
+// was interrupted before the client finished.
+type ClientMetrics struct {
+	ClientId   int
+	File       string
+	Start      time.Time
+	End        time.Time
+	Types      map[string]*TypeMetrics
+	Malformed  int64
+	Warmup     int64
+	Cooldown   int64
+	Incomplete bool
+}
+
+func NewClientMetrics(clientId int, file string) *ClientMetrics {
+	m := &ClientMetrics{ClientId: clientId, File: file, Start: time.Now(), Types: make(map[string]*TypeMetrics, len(TxnTypes))}
+	for _, t := range TxnTypes {
+		m.Types[t] = &TypeMetrics{Latency: NewHistogram()}
+	}
+	return m
+}
+
+// Record adds one executed transaction of type txnType.
+func (m *ClientMetrics) Record(txnType string, outcome Outcome, retries int, latency time.Duration) {
+	tm := m.Types[txnType]
+	tm.Outcomes[outcome]++
+	tm.Retries += int64(retries)
+	if outcome == OutcomeCommitted {
+		tm.Latency.Record(latency)
+	}
+}
+
+// Latency returns the latencies of all types merged.
+func (m *ClientMetrics) Latency() *Histogram {
+	h := NewHistogram()
+	for _, tm := range m.Types {
+		h.Merge(tm.Latency)
+	}
+	return h
+}
+
+// Committed returns the committed transactions of all types.
+func (m *ClientMetrics) Committed() int64 {
+	var committed int64
+	for _, tm := range m.Types {
+		committed += tm.Outcomes[OutcomeCommitted]
+	}
+	return committed
+}
+
+// LatencySummary condenses a latency histogram, in µs.
+type LatencySummary struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean_us"`
+	Min   int64   `json:"min_us"`
+	P50   int64   `json:"p50_us"`
+	P90   int64   `json:"p90_us"`
+	P95   int64   `json:"p95_us"`
+	P99   int64   `json:"p99_us"`
+	P999  int64   `json:"p99_9_us"`
+	Max   int64   `json:"max_us"`
+}
+
+func summarize(h *Histogram) LatencySummary {
+	return LatencySummary{
+		Count: h.Count(),
+		Mean:  h.Mean(),
+		Min:   h.Min(),
+		P50:   h.Percentile(50),
+		P90:   h.Percentile(90),
+		P95:   h.Percentile(95),
+		P99:   h.Percentile(99),
+		P999:  h.Percentile(99.9),
+		Max:   h.Max(),
+	}
+}
+
+var latencySummaryHeader = []string{"count", "mean_us", "min_us", "p50_us", "p90_us", "p95_us", "p99_us", "p99_9_us", "max_us"}
+
+func (s LatencySummary) record() []string {
+	return []string{
+		fmt.Sprint(s.Count), fmt.Sprintf("%.1f", s.Mean), fmt.Sprint(s.Min),
+		fmt.Sprint(s.P50), fmt.Sprint(s.P90), fmt.Sprint(s.P95),
+		fmt.Sprint(s.P99), fmt.Sprint(s.P999), fmt.Sprint(s.Max),
+	}
+}
+
+// TypeReport is the JSON form of TypeMetrics. Histogram keeps the full
+// latency distribution so reports can merge clients exactly.
+type TypeReport struct {
+	Committed int64          `json:"committed"`
+	Aborted   int64          `json:"aborted"`
+	Invalid   int64          `json:"invalid"`
+	Partial   int64          `json:"partial"`
+	Retries   int64          `json:"retries"`
+	Latency   LatencySummary `json:"latency"`
+	Histogram *Histogram     `json:"histogram"`
+}
+
+// ClientReport is the self-describing JSON metrics file of one client.
+type ClientReport struct {
+	RunId      string                 `json:"run_id"`
+	ClientId   int                    `json:"client_id"`
+	File       string                 `json:"file"`
+	ConfigHash string                 `json:"config_hash"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Seconds    float64                `json:"seconds"`
+	Committed  int64                  `json:"committed"`
+	Throughput float64                `json:"throughput"`
+	Malformed  int64                  `json:"malformed"`
+	Warmup     int64                  `json:"warmup_excluded"`
+	Cooldown   int64                  `json:"cooldown_excluded"`
+	Incomplete bool                   `json:"incomplete"`
+	Latency    LatencySummary         `json:"latency"`
+	Types      map[string]*TypeReport `json:"types"`
+}
+
+// MetricsWriter writes the metrics of the clients of one run in the formats
+// of metrics.formats: JSON and CSV go to <dir>/<run id>/client-<id>.*, the
+// legacy line to <dir>/<id>_metrics.txt. Time series go to
+// <dir>/<run id>/client-<id>-series.csv.
+type MetricsWriter struct {
+	Dir        string
+	RunId      string
+	ConfigHash string
+	Formats    []string
+	Interval   time.Duration
+}
+
+func NewMetricsWriter(cfg *Config, runId string) (*MetricsWriter, error) {
+	w := &MetricsWriter{
+		Dir:        cfg.Metrics.Dir,
+		RunId:      runId,
+		ConfigHash: cfg.Hash(),
+		Formats:    splitList(cfg.Metrics.Formats),
+		Interval:   cfg.Metrics.Interval,
+	}
+	if err := os.MkdirAll(w.RunDir(), 0777); err != nil {
+		return nil, fmt.Errorf("create metrics dir failed: %v", err)
+	}
+	return w, nil
+}
+
+// RunDir is the directory of the structured metrics files of the run.
+func (w *MetricsWriter) RunDir() string {
+	return filepath.Join(w.Dir, w.RunId)
+}
+
+// OpenTimeSeries starts the time series of a client, or returns nil when they
+// are turned off.
+func (w *MetricsWriter) OpenTimeSeries(clientId int, start time.Time, resume bool) (*TimeSeries, error) {
+	if w.Interval <= 0 {
+		return nil, nil
+	}
+	return NewTimeSeries(filepath.Join(w.RunDir(), fmt.Sprintf("client-%v-series.csv", clientId)), clientId, start, w.Interval, resume)
+}
+
+func (w *MetricsWriter) Report(m *ClientMetrics) *ClientReport {
+	seconds := m.End.Sub(m.Start).Seconds()
+	r := &ClientReport{
+		RunId:      w.RunId,
+		ClientId:   m.ClientId,
+		File:       m.File,
+		ConfigHash: w.ConfigHash,
+		Start:      m.Start.UTC(),
+		End:        m.End.UTC(),
+		Seconds:    seconds,
+		Committed:  m.Committed(),
+		Malformed:  m.Malformed,
+		Warmup:     m.Warmup,
+		Cooldown:   m.Cooldown,
+		Incomplete: m.Incomplete,
+		Latency:    summarize(m.Latency()),
+		Types:      make(map[string]*TypeReport, len(m.Types)),
+	}
+	if seconds > 0 {
+		r.Throughput = float64(r.Committed) / seconds
+	}
+	for t, tm := range m.Types {
+		r.Types[t] = &TypeReport{
+			Committed: tm.Outcomes[OutcomeCommitted],
+			Aborted:   tm.Outcomes[OutcomeAborted],
+			Invalid:   tm.Outcomes[OutcomeInvalid],
+			Partial:   tm.Outcomes[OutcomePartial],
+			Retries:   tm.Retries,
+			Latency:   summarize(tm.Latency),
+			Histogram: tm.Latency,
+		}
+	}
+	return r
+}
+
+// Write writes the metrics of one client in every configured format and
+// returns the first error.
+func (w *MetricsWriter) Write(m *ClientMetrics) error {
+	r := w.Report(m)
+	var firstErr error
+	for _, format := range w.Formats {
+		var err error
+		switch format {
+		case MetricsJSON:
+			err = w.writeJSON(r)
+		case MetricsCSV:
+			err = w.writeCSV(r)
+		case MetricsLegacy:
+			err = w.writeLegacy(r)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("write %s metrics failed: %v", format, err)
+		}
+	}
+	return firstErr
+}
+
+func (w *MetricsWriter) writeJSON(r *ClientReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.RunDir(), fmt.Sprintf("client-%v.json", r.ClientId)), data, 0666)
+}
+
+// writeCSV writes one row per transaction type and a last row "all" for the
+// whole client.
+func (w *MetricsWriter) writeCSV(r *ClientReport) error {
+	file, err := os.Create(filepath.Join(w.RunDir(), fmt.Sprintf("client-%v.csv", r.ClientId)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out := csv.NewWriter(file)
+	header := []string{"run_id", "client_id", "config_hash", "start", "end", "seconds", "incomplete", "type", "committed", "aborted", "invalid", "partial", "retries", "throughput"}
+	out.Write(append(header, latencySummaryHeader...))
+	prefix := []string{r.RunId, fmt.Sprint(r.ClientId), r.ConfigHash, r.Start.Format(time.RFC3339Nano), r.End.Format(time.RFC3339Nano), fmt.Sprintf("%.3f", r.Seconds), fmt.Sprint(r.Incomplete)}
+	all := &TypeReport{}
+	for _, t := range TxnTypes {
+		tr := r.Types[t]
+		all.Committed += tr.Committed
+		all.Aborted += tr.Aborted
+		all.Invalid += tr.Invalid
+		all.Partial += tr.Partial
+		all.Retries += tr.Retries
+		row := append(prefix[:len(prefix):len(prefix)], t, fmt.Sprint(tr.Committed), fmt.Sprint(tr.Aborted), fmt.Sprint(tr.Invalid), fmt.Sprint(tr.Partial), fmt.Sprint(tr.Retries), "")
+		out.Write(append(row, tr.Latency.record()...))
+	}
+	row := append(prefix[:len(prefix):len(prefix)], "all", fmt.Sprint(all.Committed), fmt.Sprint(all.Aborted), fmt.Sprint(all.Invalid), fmt.Sprint(all.Partial), fmt.Sprint(all.Retries), fmt.Sprintf("%.2f", r.Throughput))
+	out.Write(append(row, r.Latency.record()...))
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// writeLegacy writes the original single line "count seconds throughput avg
+// median p95 p99", latencies in ms.
+func (w *MetricsWriter) writeLegacy(r *ClientReport) error {
+	line := fmt.Sprintf("%v %v %.2f %.2f %.2f %.2f %.2f", r.Committed, r.Seconds, r.Throughput,
+		r.Latency.Mean/1000, float64(r.Latency.P50)/1000, float64(r.Latency.P95)/1000, float64(r.Latency.P99)/1000)
+	return os.WriteFile(filepath.Join(w.Dir, fmt.Sprintf("%v_metrics.txt", r.ClientId)), []byte(line), 0666)
+}
@@ -40,3 +40,158 @@ type DistrictInfo struct {
 	DZip     string  `gorm:"column:d_zip"`
 	DTax     float64 `gorm:"column:d_tax"`
 }
+
+type CustomerParam struct {
+	CWId         int64   `gorm:"column:c_w_id"`
+	CDId         int64   `gorm:"column:c_d_id"`
+	CId          int64   `gorm:"column:c_id"`
+	CBalance     float64 `gorm:"column:c_balance"`
+	CYtdPayment  float64 `gorm:"column:c_ytd_payment"`
+	CPaymentCnt  int64   `gorm:"column:c_payment_cnt"`
+	CDeliveryCnt int64   `gorm:"column:c_delivery_cnt"`
+	CLastOId     int64   `gorm:"column:c_last_o_id"`
+}
+
+type Item struct {
+	IId    int64   `gorm:"column:i_id"`
+	IName  string  `gorm:"column:i_name"`
+	IPrice float64 `gorm:"column:i_price"`
+}
+
+type Stock struct {
+	SWId       int64   `gorm:"column:s_w_id"`
+	SIId       int64   `gorm:"column:s_i_id"`
+	SQty       int64   `gorm:"column:s_qty"`
+	SYtd       float64 `gorm:"column:s_ytd"`
+	SOrderCnt  int64   `gorm:"column:s_order_cnt"`
+	SRemoteCnt int64   `gorm:"column:s_remote_cnt"`
+}
+
+// StockKey names the stock row of an item at a warehouse.
+type StockKey struct {
+	Wid int64
+	Iid int64
+}
+
+type StockDelta struct {
+	Quantity    int64
+	Ytd         float64
+	OrderCount  int64
+	RemoteCount int64
+	SupplyWid   int64
+	ItemId      int64
+}
+
+// Negate returns the delta that undoes d.
+func (d *StockDelta) Negate() *StockDelta {
+	return &StockDelta{
+		Quantity:    -d.Quantity,
+		Ytd:         -d.Ytd,
+		OrderCount:  -d.OrderCount,
+		RemoteCount: -d.RemoteCount,
+		SupplyWid:   d.SupplyWid,
+		ItemId:      d.ItemId,
+	}
+}
+
+type Order struct {
+	OWId int64 `gorm:"column:o_w_id"`
+	ODId int64 `gorm:"column:o_d_id"`
+	OId  int64 `gorm:"column:o_id"`
+	OCId int64 `gorm:"column:o_c_id"`
+	// OCarrierId is -1 until the order is delivered.
+	OCarrierId int64     `gorm:"column:o_carrier_id"`
+	OOlCnt     int64     `gorm:"column:o_ol_cnt"`
+	OAllLocal  bool      `gorm:"column:o_all_local"`
+	OEntryD    time.Time `gorm:"column:o_entry_d"`
+}
+
+type Orderline struct {
+	OlWId    int64  `gorm:"column:ol_w_id"`
+	OlDId    int64  `gorm:"column:ol_d_id"`
+	OlOId    int64  `gorm:"column:ol_o_id"`
+	OlNumber int64  `gorm:"column:ol_number"`
+	OlIId    int64  `gorm:"column:ol_i_id"`
+	OlIName  string `gorm:"column:ol_i_name"`
+	// OlDeliveryD is the zero time until the order is delivered.
+	OlDeliveryD time.Time `gorm:"column:ol_delivery_d"`
+	OlAmount    float64   `gorm:"column:ol_amount"`
+	OlSupplyWId int64     `gorm:"column:ol_supply_w_id"`
+	OlQuantity  int64     `gorm:"column:ol_quantity"`
+	OlDistInfo  string    `gorm:"column:ol_dist_info"`
+}
+
+type CommonOrder struct {
+	Wid int64
+	Did int64
+	Oid int64
+}
+
+type PaymentPointer struct {
+	Wid     int64
+	Did     int64
+	Pointer time.Time
+}
+
+type PaymentHistory struct {
+	PaymentId     string
+	Wid           int64
+	Did           int64
+	Cid           int64
+	Amount        float64
+	IsWYtdUpdated int64
+	IsDYtdUpdated int64
+	CreatedAt     time.Time
+}
+
+// DBState holds the 15 statistics of the final database state, in the order
+// of the project's state report.
+type DBState struct {
+	WYtd         float64
+	DYtd         float64
+	DNextOId     int64
+	CBalance     float64
+	CYtdPayment  float64
+	CPaymentCnt  int64
+	CDeliveryCnt int64
+	OIdMax       int64
+	OOlCnt       int64
+	OlAmount     float64
+	OlQuantity   int64
+	SQuantity    int64
+	SYtd         float64
+	SOrderCnt    int64
+	SRemoteCnt   int64
+}
+
+// Violations counts the rows breaking one consistency condition, with the
+// smallest offending id as an example.
+type Violations struct {
+	Count     int64
+	ExampleId int64
+}
+
+func (v *Violations) add(id int64) {
+	if v.Count == 0 || id < v.ExampleId {
+		v.ExampleId = id
+	}
+	v.Count++
+}
+
+// DistrictState holds what the consistency check needs to know about one
+// district.
+type DistrictState struct {
+	Wid     int64
+	Did     int64
+	DYtd    float64
+	NextOId int64
+	MaxOId  int64
+	// OlCnt are the orders whose o_ol_cnt differs from their number of lines.
+	OlCnt Violations
+	// Delivery are the orders whose carrier and line delivery dates disagree:
+	// o_carrier_id is null exactly when every ol_delivery_d is.
+	Delivery Violations
+	// Balance are the customers whose c_balance + c_ytd_payment differs from
+	// the amount of their delivered orders.
+	Balance Violations
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Outcome classifies how a transaction ended.
+type Outcome int
+
+const (
+	// OutcomeCommitted: every unit of work of the transaction succeeded.
+	OutcomeCommitted Outcome = iota
+	// OutcomeAborted: a unit of work failed, after retries if its error was
+	// transient, before anything was written.
+	OutcomeAborted
+	// OutcomeInvalid: the command is malformed or references rows that do
+	// not exist.
+	OutcomeInvalid
+	// OutcomePartial: some units of work were applied before a later one
+	// failed, e.g. a Payment whose w_ytd update is left to the compensator.
+	OutcomePartial
+)
+
+var outcomeNames = [...]string{"committed", "aborted", "invalid", "partial"}
+
+func (o Outcome) String() string {
+	if o < 0 || int(o) >= len(outcomeNames) {
+		return "unknown"
+	}
+	return outcomeNames[o]
+}
+
+// failed classifies a transaction that stopped on err. applied tells whether
+// any of its writes had already been applied.
+func failed(err error, applied bool) Outcome {
+	if applied {
+		return OutcomePartial
+	}
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrNoRowsAffected) {
+		return OutcomeInvalid
+	}
+	return OutcomeAborted
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Pacing modes. In the closed loop a client starts the next command as soon
+// as the previous one finished; the open-loop modes issue commands at a
+// target arrival rate regardless of how long they take.
+const (
+	PacingClosed   = "closed"
+	PacingConstant = "constant"
+	PacingPoisson  = "poisson"
+)
+
+var pacingModes = []string{PacingClosed, PacingConstant, PacingPoisson}
+
+// Pacer schedules the arrivals of one open-loop client. When the client falls
+// behind, the commands run back to back until it catches up, and their
+// latency is measured from the intended start, so slow responses are not
+// hidden by delaying the commands queued behind them (coordinated omission).
+type Pacer struct {
+	poisson bool
+	rate    float64
+	next    time.Time
+	r       *rand.Rand
+}
+
+// NewPacer returns the pacer of an open-loop client started at start, or nil
+// in the closed loop.
+func NewPacer(cfg PacingConfig, start time.Time, seed int64) *Pacer {
+	if cfg.Mode == PacingClosed {
+		return nil
+	}
+	p := &Pacer{poisson: cfg.Mode == PacingPoisson, rate: cfg.Rate, next: start, r: rand.New(rand.NewSource(seed))}
+	if p.poisson {
+		p.next = start.Add(p.interarrival())
+	}
+	return p
+}
+
+func (p *Pacer) interarrival() time.Duration {
+	if p.poisson {
+		return time.Duration(p.r.ExpFloat64() / p.rate * float64(time.Second))
+	}
+	return time.Duration(float64(time.Second) / p.rate)
+}
+
+// Wait sleeps until the next arrival and returns its intended start time. It
+// returns ctx.Err() when ctx is done first.
+func (p *Pacer) Wait(ctx context.Context) (time.Time, error) {
+	intended := p.next
+	p.next = p.next.Add(p.interarrival())
+	return intended, sleepContext(ctx, time.Until(intended))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewPacerClosed(t *testing.T) {
+	if p := NewPacer(PacingConfig{Mode: PacingClosed}, time.Now(), 1); p != nil {
+		t.Errorf("closed loop got a pacer")
+	}
+}
+
+func TestPacerInterarrival(t *testing.T) {
+	tests := []struct {
+		mode string
+		rate float64
+		// Tolerance of the mean interarrival time, relative to 1/rate.
+		tolerance float64
+	}{
+		{PacingConstant, 50, 0},
+		{PacingConstant, 0.5, 0},
+		{PacingPoisson, 50, 0.05},
+		{PacingPoisson, 0.5, 0.05},
+	}
+	for _, tt := range tests {
+		start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+		p := NewPacer(PacingConfig{Mode: tt.mode, Rate: tt.rate}, start, 1)
+		want := time.Duration(float64(time.Second) / tt.rate)
+		const n = 10000
+		prev := p.next
+		for i := 0; i < n; i++ {
+			d := p.interarrival()
+			if d < 0 {
+				t.Fatalf("%v at %v/s: negative interarrival %v", tt.mode, tt.rate, d)
+			}
+			if tt.mode == PacingConstant && d != want {
+				t.Fatalf("%v at %v/s: interarrival %v, want %v", tt.mode, tt.rate, d, want)
+			}
+			prev = prev.Add(d)
+		}
+		mean := float64(prev.Sub(p.next)) / n
+		if math.Abs(mean/float64(want)-1) > tt.tolerance {
+			t.Errorf("%v at %v/s: mean interarrival %v, want %v", tt.mode, tt.rate, time.Duration(mean), want)
+		}
+	}
+}
+
+func TestPacerWait(t *testing.T) {
+	// A client behind its schedule runs the commands back to back, each with
+	// its own intended start.
+	start := time.Now().Add(-time.Second)
+	p := NewPacer(PacingConfig{Mode: PacingConstant, Rate: 10}, start, 1)
+	for i := 0; i < 5; i++ {
+		intended, err := p.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("wait %v: %v", i, err)
+		}
+		if want := start.Add(time.Duration(i) * 100 * time.Millisecond); !intended.Equal(want) {
+			t.Errorf("wait %v: intended %v, want %v", i, intended, want)
+		}
+	}
+
+	// A client ahead of its schedule is woken up by a cancellation.
+	p = NewPacer(PacingConfig{Mode: PacingConstant, Rate: 0.01}, time.Now().Add(time.Hour), 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled wait returned %v, want %v", err, context.Canceled)
+	}
+}
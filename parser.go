@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxNewOrderItems bounds the item count M of a NewOrder command, as in the
+// CS4224 transaction file specification.
+const MaxNewOrderItems = 20
+
+// TxnCommand is one transaction parsed from a transaction file.
+type TxnCommand interface {
+	// Type is the transaction code, one of TxnTypes.
+	Type() string
+	// Line is the line number the command starts at.
+	Line() int
+}
+
+type NewOrderItem struct {
+	ItemId    int64
+	SupplyWid int64
+	Quantity  int64
+}
+
+// NewOrderCmd is "N,C_ID,W_ID,D_ID,M" followed by M item lines.
+type NewOrderCmd struct {
+	LineNo int
+	Cid    int64
+	Wid    int64
+	Did    int64
+	Items  []*NewOrderItem
+}
+
+// PaymentCmd is "P,C_W_ID,C_D_ID,C_ID,PAYMENT".
+type PaymentCmd struct {
+	LineNo int
+	Wid    int64
+	Did    int64
+	Cid    int64
+	Amount float64
+}
+
+// DeliveryCmd is "D,W_ID,CARRIER_ID".
+type DeliveryCmd struct {
+	LineNo    int
+	Wid       int64
+	CarrierId int64
+}
+
+// OrderStatusCmd is "O,C_W_ID,C_D_ID,C_ID".
+type OrderStatusCmd struct {
+	LineNo int
+	Wid    int64
+	Did    int64
+	Cid    int64
+}
+
+// StockLevelCmd is "S,W_ID,D_ID,T,L".
+type StockLevelCmd struct {
+	LineNo    int
+	Wid       int64
+	Did       int64
+	Threshold int64
+	L         int64
+}
+
+// PopularItemCmd is "I,W_ID,D_ID,L".
+type PopularItemCmd struct {
+	LineNo int
+	Wid    int64
+	Did    int64
+	L      int64
+}
+
+// TopBalanceCmd is "T".
+type TopBalanceCmd struct {
+	LineNo int
+}
+
+// RelatedCustomerCmd is "R,C_W_ID,C_D_ID,C_ID".
+type RelatedCustomerCmd struct {
+	LineNo int
+	Wid    int64
+	Did    int64
+	Cid    int64
+}
+
+func (c *NewOrderCmd) Type() string        { return "N" }
+func (c *PaymentCmd) Type() string         { return "P" }
+func (c *DeliveryCmd) Type() string        { return "D" }
+func (c *OrderStatusCmd) Type() string     { return "O" }
+func (c *StockLevelCmd) Type() string      { return "S" }
+func (c *PopularItemCmd) Type() string     { return "I" }
+func (c *TopBalanceCmd) Type() string      { return "T" }
+func (c *RelatedCustomerCmd) Type() string { return "R" }
+
+func (c *NewOrderCmd) Line() int        { return c.LineNo }
+func (c *PaymentCmd) Line() int         { return c.LineNo }
+func (c *DeliveryCmd) Line() int        { return c.LineNo }
+func (c *OrderStatusCmd) Line() int     { return c.LineNo }
+func (c *StockLevelCmd) Line() int      { return c.LineNo }
+func (c *PopularItemCmd) Line() int     { return c.LineNo }
+func (c *TopBalanceCmd) Line() int      { return c.LineNo }
+func (c *RelatedCustomerCmd) Line() int { return c.LineNo }
+
+// ParseError locates a malformed line of a transaction file. Type is the
+// transaction code of the command, or empty when the line does not start
+// with one.
+type ParseError struct {
+	File string
+	Line int
+	Type string
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("%s:%v: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%v: %v: %q", e.File, e.Line, e.Err, e.Text)
+}
+
+// Parser reads the commands of one transaction file. A malformed command is
+// reported as a *ParseError and skipped, so parsing can go on with the next
+// one.
+type Parser struct {
+	file    string
+	scanner *bufio.Scanner
+	line    int
+	text    string
+}
+
+func NewParser(r io.Reader, file string) *Parser {
+	return &Parser{file: file, scanner: bufio.NewScanner(r)}
+}
+
+// scan advances to the next line, returning false at the end of the input.
+func (p *Parser) scan() bool {
+	if !p.scanner.Scan() {
+		return false
+	}
+	p.line++
+	p.text = strings.TrimSpace(p.scanner.Text())
+	return true
+}
+
+func (p *Parser) errorf(line int, text string, format string, args ...interface{}) *ParseError {
+	return &ParseError{File: p.file, Line: line, Text: text, Err: fmt.Errorf(format, args...)}
+}
+
+// Next returns the next command, io.EOF after the last one, or a *ParseError
+// for a malformed command. Blank lines are skipped.
+func (p *Parser) Next() (TxnCommand, error) {
+	for {
+		if !p.scan() {
+			if err := p.scanner.Err(); err != nil {
+				return nil, fmt.Errorf("read %s failed: %v", p.file, err)
+			}
+			return nil, io.EOF
+		}
+		if p.text != "" {
+			break
+		}
+	}
+
+	f := &fieldParser{fields: strings.Split(p.text, ",")}
+	line, text := p.line, p.text
+	var cmd TxnCommand
+	switch f.fields[0] {
+	case "N":
+		if !f.count(5) {
+			break
+		}
+		c := &NewOrderCmd{LineNo: line, Cid: f.id(1, "C_ID"), Wid: f.id(2, "W_ID"), Did: f.district(3)}
+		m := f.int(4, "M", 1, MaxNewOrderItems)
+		if f.err != nil {
+			// The item lines cannot be told apart from the next command
+			// without M, so they are only skipped when M is a number.
+			if n, err := strconv.Atoi(strings.TrimSpace(f.fields[4])); err == nil && n > 0 {
+				p.skip(n)
+			}
+			break
+		}
+		items, err := p.newOrderItems(int(m))
+		if perr, ok := err.(*ParseError); ok {
+			perr.Type = "N"
+			return nil, perr
+		} else if err != nil {
+			return nil, err
+		}
+		c.Items = items
+		cmd = c
+	case "P":
+		if f.count(5) {
+			cmd = &PaymentCmd{LineNo: line, Wid: f.id(1, "C_W_ID"), Did: f.district(2), Cid: f.id(3, "C_ID"), Amount: f.amount(4)}
+		}
+	case "D":
+		if f.count(3) {
+			cmd = &DeliveryCmd{LineNo: line, Wid: f.id(1, "W_ID"), CarrierId: f.int(2, "CARRIER_ID", 1, MaxCarrierId)}
+		}
+	case "O":
+		if f.count(4) {
+			cmd = &OrderStatusCmd{LineNo: line, Wid: f.id(1, "C_W_ID"), Did: f.district(2), Cid: f.id(3, "C_ID")}
+		}
+	case "S":
+		if f.count(5) {
+			cmd = &StockLevelCmd{LineNo: line, Wid: f.id(1, "W_ID"), Did: f.district(2), Threshold: f.id(3, "T"), L: f.id(4, "L")}
+		}
+	case "I":
+		if f.count(4) {
+			cmd = &PopularItemCmd{LineNo: line, Wid: f.id(1, "W_ID"), Did: f.district(2), L: f.id(3, "L")}
+		}
+	case "T":
+		if f.count(1) {
+			cmd = &TopBalanceCmd{LineNo: line}
+		}
+	case "R":
+		if f.count(4) {
+			cmd = &RelatedCustomerCmd{LineNo: line, Wid: f.id(1, "C_W_ID"), Did: f.district(2), Cid: f.id(3, "C_ID")}
+		}
+	default:
+		f.fail("unknown transaction type %q", f.fields[0])
+	}
+	if f.err != nil {
+		perr := p.errorf(line, text, "%v", f.err)
+		if isTxnType(f.fields[0]) {
+			perr.Type = f.fields[0]
+		}
+		return nil, perr
+	}
+	return cmd, nil
+}
+
+// newOrderItems reads the m item lines of a NewOrder. On a malformed item
+// line the remaining item lines are still consumed.
+func (p *Parser) newOrderItems(m int) ([]*NewOrderItem, error) {
+	items := make([]*NewOrderItem, 0, m)
+	var parseErr *ParseError
+	for i := 0; i < m; i++ {
+		if !p.scan() {
+			if err := p.scanner.Err(); err != nil {
+				return nil, fmt.Errorf("read %s failed: %v", p.file, err)
+			}
+			return nil, p.errorf(p.line, "", "unexpected end of file: NewOrder has %v of %v item lines", i, m)
+		}
+		f := &fieldParser{fields: strings.Split(p.text, ",")}
+		if f.count(3) {
+			items = append(items, &NewOrderItem{
+				ItemId:    f.int(0, "OL_I_ID", 1, ItemCount),
+				SupplyWid: f.id(1, "OL_SUPPLY_W_ID"),
+				Quantity:  f.id(2, "OL_QUANTITY"),
+			})
+		}
+		if f.err != nil && parseErr == nil {
+			parseErr = p.errorf(p.line, p.text, "NewOrder item %v: %v", i+1, f.err)
+		}
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return items, nil
+}
+
+func (p *Parser) skip(n int) {
+	for i := 0; i < n && p.scan(); i++ {
+	}
+}
+
+// fieldParser converts the fields of one line, keeping the first error.
+type fieldParser struct {
+	fields []string
+	err    error
+}
+
+func (f *fieldParser) fail(format string, args ...interface{}) {
+	if f.err == nil {
+		f.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (f *fieldParser) count(n int) bool {
+	if len(f.fields) != n {
+		f.fail("expected %v fields, got %v", n, len(f.fields))
+		return false
+	}
+	return true
+}
+
+// int parses field i and checks it lies in [min, max].
+func (f *fieldParser) int(i int, name string, min, max int64) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(f.fields[i]), 10, 64)
+	if err != nil {
+		f.fail("%s: invalid integer %q", name, f.fields[i])
+		return 0
+	}
+	if v < min || v > max {
+		f.fail("%s out of range [%v, %v]: %v", name, min, max, v)
+		return 0
+	}
+	return v
+}
+
+// id parses a positive integer.
+func (f *fieldParser) id(i int, name string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(f.fields[i]), 10, 64)
+	if err != nil {
+		f.fail("%s: invalid integer %q", name, f.fields[i])
+		return 0
+	}
+	if v <= 0 {
+		f.fail("%s must be positive: %v", name, v)
+		return 0
+	}
+	return v
+}
+
+func (f *fieldParser) district(i int) int64 {
+	return f.int(i, "D_ID", 1, DistrictsPerWarehouse)
+}
+
+func (f *fieldParser) amount(i int) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(f.fields[i]), 64)
+	if err != nil {
+		f.fail("PAYMENT: invalid number %q", f.fields[i])
+		return 0
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		f.fail("PAYMENT must be finite: %v", v)
+		return 0
+	}
+	if v <= 0 {
+		f.fail("PAYMENT must be positive: %v", v)
+		return 0
+	}
+	return v
+}
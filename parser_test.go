@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParserCommands(t *testing.T) {
+	input := strings.Join([]string{
+		"N,7,1,2,2",
+		"100,1,5",
+		"200,2,3",
+		"",
+		"P,1,2,3,10.5",
+		"D,1,10",
+		"O,1,2,3",
+		"S,1,2,15,10",
+		"I,1,2,20",
+		"T",
+		"R,1,2,3",
+	}, "\n")
+	want := []TxnCommand{
+		&NewOrderCmd{LineNo: 1, Cid: 7, Wid: 1, Did: 2, Items: []*NewOrderItem{{ItemId: 100, SupplyWid: 1, Quantity: 5}, {ItemId: 200, SupplyWid: 2, Quantity: 3}}},
+		&PaymentCmd{LineNo: 5, Wid: 1, Did: 2, Cid: 3, Amount: 10.5},
+		&DeliveryCmd{LineNo: 6, Wid: 1, CarrierId: 10},
+		&OrderStatusCmd{LineNo: 7, Wid: 1, Did: 2, Cid: 3},
+		&StockLevelCmd{LineNo: 8, Wid: 1, Did: 2, Threshold: 15, L: 10},
+		&PopularItemCmd{LineNo: 9, Wid: 1, Did: 2, L: 20},
+		&TopBalanceCmd{LineNo: 10},
+		&RelatedCustomerCmd{LineNo: 11, Wid: 1, Did: 2, Cid: 3},
+	}
+
+	p := NewParser(strings.NewReader(input), "test.txt")
+	for _, w := range want {
+		cmd, err := p.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		if !reflect.DeepEqual(cmd, w) {
+			t.Errorf("Next() = %+v, want %+v", cmd, w)
+		}
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("Next() at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+		typ   string
+		err   string
+		// next is the type of the command parsed after the error, if any.
+		next string
+	}{
+		{"unknown type", "X,1,2\nT", 1, "", "unknown transaction type", "T"},
+		{"field count", "P,1,2,3\nT", 1, "P", "expected 5 fields, got 4", "T"},
+		{"not a number", "O,1,two,3\nT", 1, "O", "D_ID: invalid integer", "T"},
+		{"district out of range", "O,1,11,3\nT", 1, "O", "D_ID out of range [1, 10]: 11", "T"},
+		{"id not positive", "R,0,1,3\nT", 1, "R", "C_W_ID must be positive", "T"},
+		{"carrier out of range", "D,1,11\nT", 1, "D", "CARRIER_ID out of range", "T"},
+		{"payment not positive", "P,1,2,3,-1\nT", 1, "P", "PAYMENT must be positive", "T"},
+		{"payment not a number", "P,1,2,3,NaN\nT", 1, "P", "PAYMENT must be finite", "T"},
+		{"payment infinite", "P,1,2,3,+Inf\nT", 1, "P", "PAYMENT must be finite", "T"},
+		{"payment negative infinite", "P,1,2,3,-inf\nT", 1, "P", "PAYMENT must be finite", "T"},
+		// The item lines are skipped when M is a number, even out of range.
+		{"too many items", "N,1,1,1,21\nT", 1, "N", "M out of range", ""},
+		{"bad header skips items", "N,x,1,1,2\n1,1,1\n2,1,1\nT", 1, "N", "C_ID: invalid integer", "T"},
+		{"bad item line", "N,1,1,1,2\n1,1,1\n2,0,1\nT", 3, "N", "", "T"},
+		{"missing item lines", "N,1,1,1,3\n1,1,1", 2, "N", "unexpected end of file", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser(strings.NewReader(tt.input), "test.txt")
+			_, err := p.Next()
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Next() error = %v, want a *ParseError", err)
+			}
+			if perr.File != "test.txt" || perr.Line != tt.line || perr.Type != tt.typ || !strings.Contains(perr.Error(), tt.err) {
+				t.Errorf("Next() error = %v (line %v, type %q), want line %v, type %q and %q", perr, perr.Line, perr.Type, tt.line, tt.typ, tt.err)
+			}
+
+			cmd, err := p.Next()
+			if tt.next == "" {
+				if err != io.EOF {
+					t.Errorf("Next() after the error = %v, %v, want io.EOF", cmd, err)
+				}
+			} else if err != nil || cmd.Type() != tt.next {
+				t.Errorf("Next() after the error = %v, %v, want a %s command", cmd, err, tt.next)
+			}
+		})
+	}
+}
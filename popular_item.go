@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"strings"
 	"time"
-
-	"gorm.io/gorm"
 )
 
 type OrderOutput struct {
@@ -21,123 +19,62 @@ type OrderOutput struct {
 	PopularItemQuantity int64
 }
 
-type PopularItemOrderline struct {
-	OrderId  int64
-	ItemId   int64
-	Quantity int64
-}
-
-func PopularItem(logs *log.Logger, db *gorm.DB, words []string, scanner *bufio.Scanner, lineCount *int) error {
-	wid := SafeParseInt64(words[1])
-	did := SafeParseInt64(words[2])
-	l := SafeParseInt64(words[3])
+func PopularItem(ctx context.Context, logs *log.Logger, store Store, retry *Retrier, cmd *PopularItemCmd) Outcome {
+	wid, did := cmd.Wid, cmd.Did
+	l := cmd.L
 
 	var nextOrderId int64
-	getOrderIdTxn := func() error {
-		return db.Transaction(func(tx *gorm.DB) error {
-			tx = tx.Raw(`
-				select d_next_o_id 
-				from district_order_id 
-				where d_w_id=? and d_id=?
-			`, wid, did)
-			if err := tx.Row().Scan(&nextOrderId); err != nil {
-				return err
-			}
-			return nil
-		})
+	getOrderIdTxn := func() (err error) {
+		nextOrderId, err = store.GetNextOrderId(ctx, wid, did)
+		return err
 	}
-	if err := Retry(getOrderIdTxn); err != nil {
+	if err := retry.Do(ctx, getOrderIdTxn); err != nil {
 		logs.Printf("popular item get order id failed: %v", err)
-		return nil
+		return failed(err, false)
 	}
 	orderIdStart := nextOrderId - l
 
-	orderOutputs := make([]*OrderOutput, 0)
-	orderlines := make([]*PopularItemOrderline, 0)
-	cids := make([]int64, 0)
-	itemIdSet := make(map[int64]bool, 0)
+	var orderOutputs []*OrderOutput
+	var orderlines []*Orderline
 	getOrderAndOrderlineTxn := func() error {
-		return db.Transaction(func(tx *gorm.DB) error {
-			tx = tx.Raw(`
-				select o_id, o_entry_d, o_c_id 
-				from orders 
-				where o_w_id=? and o_d_id=? and o_id >= ?
-			`, wid, did, orderIdStart)
-			rows, err := tx.Rows()
-			if err != nil {
-				return err
-			}
-			for rows.Next() {
-				o := &OrderOutput{}
-				if err := rows.Scan(&o.OrderId, &o.EntryDate, &o.Cid); err != nil {
-					return err
-				}
-				orderOutputs = append(orderOutputs, o)
-				cids = append(cids, o.Cid)
-			}
-
-			tx = tx.Raw(`
-				select ol_o_id, ol_i_id, ol_quantity 
-				from order_lines 
-				where ol_w_id = ? and ol_d_id = ? and ol_o_id >= ?
-			`, wid, did, orderIdStart)
-			rows, err = tx.Rows()
-			if err != nil {
-				return err
-			}
-			for rows.Next() {
-				ol := &PopularItemOrderline{}
-				if err := rows.Scan(&ol.OrderId, &ol.ItemId, &ol.Quantity); err != nil {
-					return err
-				}
-				orderlines = append(orderlines, ol)
-				itemIdSet[ol.ItemId] = true
-			}
-			return nil
-		})
+		orders, lines, err := store.GetOrdersWithLinesFrom(ctx, wid, did, orderIdStart)
+		if err != nil {
+			return err
+		}
+		orderOutputs = make([]*OrderOutput, 0, len(orders))
+		for _, o := range orders {
+			orderOutputs = append(orderOutputs, &OrderOutput{OrderId: o.OId, EntryDate: o.OEntryD, Cid: o.OCId})
+		}
+		orderlines = lines
+		return nil
 	}
-	if err := Retry(getOrderAndOrderlineTxn); err != nil {
+	if err := retry.Do(ctx, getOrderAndOrderlineTxn); err != nil {
 		logs.Printf("get orders and orderlines failed: %v", err)
-		return nil
+		return failed(err, false)
 	}
 
+	itemIdSet := make(map[int64]bool, 0)
+	for _, ol := range orderlines {
+		itemIdSet[ol.OlIId] = true
+	}
 	itemIds := make([]int64, 0, len(itemIdSet))
 	for itemId := range itemIdSet {
 		itemIds = append(itemIds, itemId)
 	}
 
 	for _, o := range orderOutputs {
-		db = db.Raw(`
-			SELECT c_first, c_middle, c_last
-			FROM customer_info
-			WHERE c_w_id = ? AND c_d_id = ? AND c_id = ?
-			LIMIT 1
-		`, wid, did, o.Cid)
-		if err := db.Row().Scan(&o.CFirst, &o.CMiddle, &o.CLast); err != nil {
+		ci, err := store.GetCustomerInfo(ctx, wid, did, o.Cid)
+		if err != nil {
 			logs.Printf("popular item get customer name failed: %v", err)
-			return nil
+			return failed(err, false)
 		}
+		o.CFirst, o.CMiddle, o.CLast = ci.CFirst, ci.CMiddle, ci.CLast
 	}
 
-	itemIdToItemName := make(map[int64]string, 0)
-	db = db.Raw(`
-		select i_id, i_name 
-		from items 
-		where i_id in ?
-	`, itemIds)
-	rows, err := db.Rows()
+	itemIdToItemName, err := store.GetItemNames(ctx, itemIds)
 	if err != nil {
 		logs.Printf("popular item get item names failed: %v", err)
-		return nil
-	}
-	for rows.Next() {
-		var id int64
-		var name string
-		if err := rows.Scan(&id, &name); err != nil {
-			logs.Printf("popular item scan item names failed: %v", err)
-			return nil
-		}
-		itemIdToItemName[id] = name
+		return failed(err, false)
 	}
 
 	popularItemIdtoCount := make(map[int64]int64, 0)
@@ -146,14 +83,14 @@ func PopularItem(logs *log.Logger, db *gorm.DB, words []string, scanner *bufio.S
 		var maxQuantity int64 = 0
 		popularItemIds := make([]int64, 0)
 		for _, ol := range orderlines {
-			if ol.OrderId != o.OrderId {
+			if ol.OlOId != o.OrderId {
 				continue
 			}
-			if ol.Quantity > maxQuantity {
-				popularItemIds = []int64{ol.ItemId}
-				maxQuantity = ol.Quantity
-			} else if ol.Quantity == maxQuantity {
-				popularItemIds = append(popularItemIds, ol.ItemId)
+			if ol.OlQuantity > maxQuantity {
+				popularItemIds = []int64{ol.OlIId}
+				maxQuantity = ol.OlQuantity
+			} else if ol.OlQuantity == maxQuantity {
+				popularItemIds = append(popularItemIds, ol.OlIId)
 			}
 		}
 
@@ -181,5 +118,5 @@ func PopularItem(logs *log.Logger, db *gorm.DB, words []string, scanner *bufio.S
 	}
 	logs.Printf(sb.String())
 
-	return nil
+	return OutcomeCommitted
 }
@@ -1,91 +1,60 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"strings"
-
-	"gorm.io/gorm"
 )
 
-type CommonOrder struct {
-	Wid int64
-	Did int64
-	Oid int64
-}
-
-func RelatedCustomer(logs *log.Logger, db *gorm.DB, words []string, scanner *bufio.Scanner, lineCount *int) error {
-	wid := SafeParseInt64(words[1])
-	did := SafeParseInt64(words[2])
-	cid := SafeParseInt64(words[3])
+func RelatedCustomer(ctx context.Context, logs *log.Logger, store Store, retry *Retrier, cmd *RelatedCustomerCmd) Outcome {
+	wid, did, cid := cmd.Wid, cmd.Did, cmd.Cid
 
 	// get orders
-	oids := make([]int64, 0)
-	db = db.Raw(`
-		select o_id 
-		from orders 
-		where o_w_id = ? and o_d_id = ? and o_c_id = ?
-		LIMIT 10000
-	`, wid, did, cid).Scan(&oids)
-	if db.Error != nil {
-		logs.Printf("related customer get order id failed: %v", db.Error)
-		return nil
+	var oids []int64
+	getOrderIdsTxn := func() (err error) {
+		oids, err = store.GetCustomerOrderIds(ctx, wid, did, cid)
+		return err
+	}
+	if err := retry.Do(ctx, getOrderIdsTxn); err != nil {
+		logs.Printf("related customer get order id failed: %v", err)
+		return failed(err, false)
 	}
 
 	commonOrders := make([]*CommonOrder, 0)
 	for _, oid := range oids {
-		itemIds := make([]int64, 0)
-		db = db.Raw(`
-			select ol_i_id 
-			from order_lines
-			where ol_w_id = ? and ol_d_id = ? and ol_o_id = ?
-		`, wid, did, oid).Scan(&itemIds)
-		if db.Error != nil {
-			logs.Printf("related customer get order line item ids failed: %v", db.Error)
-			return nil
+		var orders []*CommonOrder
+		getCommonOrdersTxn := func() error {
+			itemIds, err := store.GetOrderlineItemIds(ctx, wid, did, oid, oid)
+			if err != nil {
+				return err
+			}
+			orders, err = store.GetOrdersSharingItems(ctx, wid, itemIds, 2)
+			return err
 		}
-
-		db = db.Raw(`
-			select ol_w_id, ol_d_id, ol_o_id 
-			from order_lines 
-			where ol_w_id != ? and ol_i_id in (?) 
-			group by ol_w_id, ol_d_id, ol_o_id 
-			having count(ol_i_id) >= 2
-		`, wid, itemIds)
-		rows, err := db.Rows()
-		if err != nil {
+		if err := retry.Do(ctx, getCommonOrdersTxn); err != nil {
 			logs.Printf("related customer get order lines failed: %v", err)
-			return nil
-		}
-		for rows.Next() {
-			co := &CommonOrder{}
-			if err := rows.Scan(&co.Wid, &co.Did, &co.Oid); err != nil {
-				logs.Printf("related customer scan order lines failed: %v", err)
-				return nil
-			}
-			commonOrders = append(commonOrders, co)
+			return failed(err, false)
 		}
+		commonOrders = append(commonOrders, orders...)
 	}
 
 	if len(commonOrders) == 0 {
 		logs.Printf("There is no related customer")
-		return nil
+		return OutcomeCommitted
 	}
 
 	cidSet := make(map[int64]bool, 0)
 	sb := strings.Builder{}
 	for _, co := range commonOrders {
 		var cid int64
-		db = db.Raw(`
-			SELECT o_c_id
-			FROM orders 
-			WHERE o_w_id = ? AND o_d_id = ? AND o_id = ?
-			LIMIT 1
-		`, co.Wid, co.Did, co.Oid)
-		if err := db.Row().Scan(&cid); err != nil {
+		getCustomerIdTxn := func() (err error) {
+			cid, err = store.GetOrderCustomerId(ctx, co.Wid, co.Did, co.Oid)
+			return err
+		}
+		if err := retry.Do(ctx, getCustomerIdTxn); err != nil {
 			logs.Printf("related customer scan customer failed: %v", err)
-			return nil
+			return failed(err, false)
 		}
 
 		if cidSet[cid] {
@@ -95,5 +64,5 @@ func RelatedCustomer(logs *log.Logger, db *gorm.DB, words []string, scanner *buf
 		sb.WriteString(fmt.Sprintf("related customer identifier: w_id: %v, d_id: %v. c_id: %v\n", co.Wid, co.Did, cid))
 	}
 	logs.Printf(sb.String())
-	return nil
+	return OutcomeCommitted
 }
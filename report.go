@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RunReport aggregates the client metrics of one run.
+type RunReport struct {
+	RunId   string
+	Clients []*ClientReport
+	// Types merges the clients per transaction type; "all" merges every type.
+	Types map[string]*TypeReport
+}
+
+// loadRunReport reads every client-*.json file of dir.
+func loadRunReport(dir string) (*RunReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "client-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no client metrics files in %s", dir)
+	}
+
+	report := &RunReport{RunId: filepath.Base(dir), Types: make(map[string]*TypeReport, len(TxnTypes)+1)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		client := &ClientReport{}
+		if err := json.Unmarshal(data, client); err != nil {
+			return nil, fmt.Errorf("parse %s failed: %v", path, err)
+		}
+		report.Clients = append(report.Clients, client)
+	}
+	sort.Slice(report.Clients, func(i, j int) bool {
+		return report.Clients[i].ClientId < report.Clients[j].ClientId
+	})
+
+	for _, t := range append(TxnTypes[:len(TxnTypes):len(TxnTypes)], "all") {
+		report.Types[t] = &TypeReport{Histogram: NewHistogram()}
+	}
+	all := report.Types["all"]
+	for _, client := range report.Clients {
+		for _, t := range TxnTypes {
+			tr, ok := client.Types[t]
+			if !ok {
+				continue
+			}
+			for _, merged := range []*TypeReport{report.Types[t], all} {
+				merged.Committed += tr.Committed
+				merged.Aborted += tr.Aborted
+				merged.Invalid += tr.Invalid
+				merged.Partial += tr.Partial
+				merged.Retries += tr.Retries
+				if tr.Histogram != nil {
+					merged.Histogram.Merge(tr.Histogram)
+				}
+			}
+		}
+	}
+	for _, tr := range report.Types {
+		tr.Latency = summarize(tr.Histogram)
+	}
+	return report, nil
+}
+
+// Incomplete returns the ids of the clients whose run was interrupted.
+func (r *RunReport) Incomplete() []string {
+	ids := make([]string, 0)
+	for _, client := range r.Clients {
+		if client.Incomplete {
+			ids = append(ids, fmt.Sprint(client.ClientId))
+		}
+	}
+	return ids
+}
+
+// ConfigHashes returns the distinct config hashes of the clients.
+func (r *RunReport) ConfigHashes() []string {
+	hashes := make([]string, 0)
+	for _, client := range r.Clients {
+		if !contains(hashes, client.ConfigHash) {
+			hashes = append(hashes, client.ConfigHash)
+		}
+	}
+	return hashes
+}
+
+// Throughput returns the minimum, average and maximum client throughput.
+func (r *RunReport) Throughput() (min, avg, max float64) {
+	for i, client := range r.Clients {
+		if i == 0 || client.Throughput < min {
+			min = client.Throughput
+		}
+		if i == 0 || client.Throughput > max {
+			max = client.Throughput
+		}
+		avg += client.Throughput
+	}
+	return min, avg / float64(len(r.Clients)), max
+}
+
+func ms(us float64) string {
+	return fmt.Sprintf("%.2f", us/1000)
+}
+
+// clientRows is the per client table, in the column order of the course's
+// clients.csv.
+func (r *RunReport) clientRows() [][]string {
+	rows := [][]string{{"client", "transactions", "seconds", "throughput", "avg_ms", "median_ms", "p95_ms", "p99_ms", "aborted", "invalid", "partial", "retries", "incomplete"}}
+	for _, c := range r.Clients {
+		var aborted, invalid, partial, retries int64
+		for _, tr := range c.Types {
+			aborted += tr.Aborted
+			invalid += tr.Invalid
+			partial += tr.Partial
+			retries += tr.Retries
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(c.ClientId), fmt.Sprint(c.Committed), fmt.Sprintf("%.2f", c.Seconds), fmt.Sprintf("%.2f", c.Throughput),
+			ms(c.Latency.Mean), ms(float64(c.Latency.P50)), ms(float64(c.Latency.P95)), ms(float64(c.Latency.P99)),
+			fmt.Sprint(aborted), fmt.Sprint(invalid), fmt.Sprint(partial), fmt.Sprint(retries), fmt.Sprint(c.Incomplete),
+		})
+	}
+	return rows
+}
+
+func (r *RunReport) throughputRows() [][]string {
+	min, avg, max := r.Throughput()
+	return [][]string{
+		{"min_throughput", "avg_throughput", "max_throughput"},
+		{fmt.Sprintf("%.2f", min), fmt.Sprintf("%.2f", avg), fmt.Sprintf("%.2f", max)},
+	}
+}
+
+// latencyRows holds the latencies merged across clients, per type and in total.
+func (r *RunReport) latencyRows() [][]string {
+	header := []string{"type", "committed", "aborted", "invalid", "partial", "retries"}
+	rows := [][]string{append(header, latencySummaryHeader...)}
+	for _, t := range append(TxnTypes[:len(TxnTypes):len(TxnTypes)], "all") {
+		tr := r.Types[t]
+		row := []string{t, fmt.Sprint(tr.Committed), fmt.Sprint(tr.Aborted), fmt.Sprint(tr.Invalid), fmt.Sprint(tr.Partial), fmt.Sprint(tr.Retries)}
+		rows = append(rows, append(row, tr.Latency.record()...))
+	}
+	return rows
+}
+
+func writeCSVFile(path string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out := csv.NewWriter(file)
+	out.WriteAll(rows)
+	if err := out.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func markdownTable(sb *strings.Builder, rows [][]string) {
+	for i, row := range rows {
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString(strings.Repeat("|---", len(row)) + "|\n")
+		}
+	}
+	sb.WriteString("\n")
+}
+
+func (r *RunReport) markdown() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("# Run %s\n\n", r.RunId))
+	sb.WriteString(fmt.Sprintf("%v clients, config hash %s.\n\n", len(r.Clients), strings.Join(r.ConfigHashes(), ", ")))
+	if ids := r.Incomplete(); len(ids) > 0 {
+		sb.WriteString(fmt.Sprintf("Incomplete: the run was interrupted before clients %s finished.\n\n", strings.Join(ids, ", ")))
+	}
+	sb.WriteString("## Throughput (committed transactions/s)\n\n")
+	markdownTable(&sb, r.throughputRows())
+	sb.WriteString("## Clients\n\n")
+	markdownTable(&sb, r.clientRows())
+	sb.WriteString("## Latency per transaction type (µs, merged across clients)\n\n")
+	markdownTable(&sb, r.latencyRows())
+	return sb.String()
+}
+
+func hasClientMetrics(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "client-*.json"))
+	return len(matches) > 0
+}
+
+// resolveRunDir finds the metrics directory of the run named by arg, by
+// metrics.run_id or, failing both, the most recent run under metrics.dir.
+// arg may also be a path to the run directory itself.
+func resolveRunDir(cfg *Config, arg string) (string, error) {
+	if arg != "" {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			return arg, nil
+		}
+		return filepath.Join(cfg.Metrics.Dir, arg), nil
+	}
+	if cfg.Metrics.RunId != "" {
+		return filepath.Join(cfg.Metrics.Dir, cfg.Metrics.RunId), nil
+	}
+
+	// Run ids default to start times, which sort chronologically.
+	entries, err := os.ReadDir(cfg.Metrics.Dir)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if hasClientMetrics(filepath.Join(cfg.Metrics.Dir, entry.Name())) {
+			latest = entry.Name()
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no runs in %s", cfg.Metrics.Dir)
+	}
+	return filepath.Join(cfg.Metrics.Dir, latest), nil
+}
+
+var dbStateHeader = []string{
+	"run_id", "w_ytd", "d_ytd", "d_next_o_id", "c_balance", "c_ytd_payment", "c_payment_cnt", "c_delivery_cnt",
+	"o_id_max", "o_ol_cnt", "ol_amount", "ol_quantity", "s_quantity", "s_ytd", "s_order_cnt", "s_remote_cnt",
+}
+
+func dbStateRows(runId string, st *DBState) [][]string {
+	money := func(v float64) string { return fmt.Sprintf("%.2f", v) }
+	return [][]string{dbStateHeader, {
+		runId, money(st.WYtd), money(st.DYtd), fmt.Sprint(st.DNextOId),
+		money(st.CBalance), money(st.CYtdPayment), fmt.Sprint(st.CPaymentCnt), fmt.Sprint(st.CDeliveryCnt),
+		fmt.Sprint(st.OIdMax), fmt.Sprint(st.OOlCnt), money(st.OlAmount), fmt.Sprint(st.OlQuantity),
+		fmt.Sprint(st.SQuantity), money(st.SYtd), fmt.Sprint(st.SOrderCnt), fmt.Sprint(st.SRemoteCnt),
+	}}
+}
+
+// reportState writes the final database state statistics to state.csv in
+// dir.
+func reportState(cfg *Config, dir string) error {
+	store, err := OpenStore(cfg)
+	if err != nil {
+		return err
+	}
+	st, err := store.GetDBState(context.Background())
+	if err != nil {
+		return fmt.Errorf("get database state failed: %v", err)
+	}
+	rows := dbStateRows(filepath.Base(dir), st)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	if err := writeCSVFile(filepath.Join(dir, "state.csv"), rows); err != nil {
+		return fmt.Errorf("write state.csv failed: %v", err)
+	}
+	sb := strings.Builder{}
+	markdownTable(&sb, rows)
+	logs.Printf("## Database state\n\n%s", sb.String())
+	return nil
+}
+
+// reportCommand aggregates the client metrics of a run into clients.csv,
+// throughput.csv, latency.csv and report.md in the run directory, and with
+// -state the final database state into state.csv.
+func reportCommand(cfg *Config, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: report [run id or directory]")
+	}
+	arg := ""
+	if len(args) == 1 {
+		arg = args[0]
+	}
+	dir, err := resolveRunDir(cfg, arg)
+	if err != nil {
+		return err
+	}
+	if cfg.Report.State {
+		if err := reportState(cfg, dir); err != nil {
+			return err
+		}
+		if !hasClientMetrics(dir) {
+			return nil
+		}
+	}
+
+	report, err := loadRunReport(dir)
+	if err != nil {
+		return err
+	}
+	if hashes := report.ConfigHashes(); len(hashes) > 1 {
+		logs.Printf("warning: clients ran with different configs: %s", strings.Join(hashes, ", "))
+	}
+	if ids := report.Incomplete(); len(ids) > 0 {
+		logs.Printf("warning: clients %s were interrupted, their metrics are incomplete", strings.Join(ids, ", "))
+	}
+
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{"clients.csv", report.clientRows()},
+		{"throughput.csv", report.throughputRows()},
+		{"latency.csv", report.latencyRows()},
+	}
+	for _, f := range files {
+		if err := writeCSVFile(filepath.Join(dir, f.name), f.rows); err != nil {
+			return fmt.Errorf("write %s failed: %v", f.name, err)
+		}
+	}
+	markdown := report.markdown()
+	if err := os.WriteFile(filepath.Join(dir, "report.md"), []byte(markdown), 0666); err != nil {
+		return fmt.Errorf("write report.md failed: %v", err)
+	}
+	logs.Printf("%s", markdown)
+	logs.Printf("report of %v clients written to %s", len(report.Clients), dir)
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// RetryPolicy bounds how often and how patiently a unit of work is retried.
+type RetryPolicy struct {
+	Attempts   int           `yaml:"attempts"`
+	BackoffMin time.Duration `yaml:"backoff_min"`
+	BackoffMax time.Duration `yaml:"backoff_max"`
+}
+
+// Backoff returns the sleep before the n-th retry: a random duration in
+// [d/2, d] where d = BackoffMin * 2^(n-1), capped at BackoffMax.
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	d := p.BackoffMin
+	for i := 1; i < n && d < p.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > p.BackoffMax {
+		d = p.BackoffMax
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// override returns p with the non-zero fields of o.
+func (p RetryPolicy) override(o RetryPolicy) RetryPolicy {
+	if o.Attempts != 0 {
+		p.Attempts = o.Attempts
+	}
+	if o.BackoffMin != 0 {
+		p.BackoffMin = o.BackoffMin
+	}
+	if o.BackoffMax != 0 {
+		p.BackoffMax = o.BackoffMax
+	}
+	return p
+}
+
+// RetryError is returned when every allowed attempt failed with a retryable
+// error.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("exceeds retry limit after %v attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// SQLSTATE codes worth another attempt. Class 08 (connection exception) is
+// matched by prefix.
+var retryableCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// IsRetryable reports whether err is transient: a serialization failure, a
+// deadlock (including the Citus distributed deadlock, which is reported as a
+// cancellation) or a lost connection. Everything else, such as missing rows
+// or constraint violations, fails the same way on every attempt.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return retryableCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08") ||
+			strings.Contains(pgErr.Message, "distributed deadlock")
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return true
+	}
+	if pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return true
+	}
+	return strings.Contains(err.Error(), "distributed deadlock") || strings.Contains(err.Error(), "conn closed")
+}
+
+// Retrier runs units of work under one RetryPolicy and counts the retries it
+// made, so a caller can report them per transaction.
+type Retrier struct {
+	policy  RetryPolicy
+	Retries int
+}
+
+func NewRetrier(policy RetryPolicy) *Retrier {
+	return &Retrier{policy: policy}
+}
+
+// Do calls fn until it succeeds, fails with an error IsRetryable rejects, or
+// runs out of attempts. It never sleeps past the deadline of ctx and returns
+// early when ctx is done.
+func (r *Retrier) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+		if attempt >= r.policy.Attempts {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+
+		sleep := r.policy.Backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < sleep {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w while retrying: %v", ctx.Err(), err)
+		case <-timer.C:
+		}
+		r.Retries++
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsRetryable(t *testing.T) {
+	pgErr := func(code, message string) error {
+		return &pgconn.PgError{Code: code, Message: message}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"serialization failure", pgErr("40001", "could not serialize access"), true},
+		{"deadlock", pgErr("40P01", "deadlock detected"), true},
+		{"wrapped deadlock", fmt.Errorf("update stocks: %w", pgErr("40P01", "deadlock detected")), true},
+		{"citus distributed deadlock", pgErr("57014", "canceling the transaction since it was involved in a distributed deadlock"), true},
+		{"admin shutdown", pgErr("57P01", "terminating connection"), true},
+		{"connection exception class", pgErr("08006", "connection failure"), true},
+		{"unique violation", pgErr("23505", "duplicate key value"), false},
+		{"undefined table", pgErr("42P01", "relation does not exist"), false},
+		{"query cancelled", pgErr("57014", "canceling statement due to user request"), false},
+		{"no rows", sql.ErrNoRows, false},
+		{"no rows affected", ErrNoRowsAffected, false},
+		{"context canceled", context.Canceled, false},
+		{"deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"conn closed", errors.New("conn closed"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetrierDo(t *testing.T) {
+	serialization := &pgconn.PgError{Code: "40001"}
+	tests := []struct {
+		name        string
+		errs        []error
+		wantCalls   int
+		wantRetries int
+		wantErr     error
+	}{
+		{"success", []error{nil}, 1, 0, nil},
+		{"retried until success", []error{serialization, serialization, nil}, 3, 2, nil},
+		{"not retryable", []error{sql.ErrNoRows}, 1, 0, sql.ErrNoRows},
+		{"out of attempts", []error{serialization, serialization, serialization, nil}, 3, 2, serialization},
+	}
+	policy := RetryPolicy{Attempts: 3, BackoffMin: time.Microsecond, BackoffMax: time.Millisecond}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRetrier(policy)
+			calls := 0
+			err := r.Do(context.Background(), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls || r.Retries != tt.wantRetries || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() = %v after %v calls and %v retries, want %v after %v calls and %v retries", err, calls, r.Retries, tt.wantErr, tt.wantCalls, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BackoffMin: 10 * time.Millisecond, BackoffMax: 50 * time.Millisecond}
+	for n, max := range []time.Duration{10, 20, 40, 50, 50} {
+		max *= time.Millisecond
+		for i := 0; i < 100; i++ {
+			if d := p.Backoff(n + 1); d < max/2 || d > max {
+				t.Fatalf("Backoff(%v) = %v, want in [%v, %v]", n+1, d, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+func runCommand(cfg *Config, args []string) error {
+	if len(args) > 0 {
+		cfg.Files = args
+	}
+	if err := cfg.ValidateRun(); err != nil {
+		return err
+	}
+	logs.Printf("run starting. TaskIndex: %v, Routines: %v, Files: %+v, NumOfCPU:%v", cfg.TaskIndex, cfg.Routines, cfg.Files, runtime.NumCPU())
+	if cfg.Commands == CommandsFiles && cfg.Routines > len(cfg.Files) {
+		logs.Printf("warning: %v routines but only %v files, %v routines stay idle", cfg.Routines, len(cfg.Files), cfg.Routines-len(cfg.Files))
+	}
+
+	runId := cfg.Metrics.RunId
+	if runId == "" {
+		runId = time.Now().UTC().Format("20060102-150405")
+	}
+	metricsWriter, err := NewMetricsWriter(cfg, runId)
+	if err != nil {
+		return err
+	}
+	logs.Printf("run id: %s, config hash: %s, metrics in %s", runId, metricsWriter.ConfigHash, metricsWriter.RunDir())
+
+	store, err := OpenStore(cfg)
+	if err != nil {
+		return err
+	}
+	// The first SIGINT or SIGTERM cancels ctx: the routines stop issuing
+	// commands, the transactions in flight are cancelled and roll back, the
+	// compensator stops, and every client writes its metrics marked
+	// incomplete. A second signal kills the process.
+	interrupted, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		<-interrupted.Done()
+		stopSignals()
+	}()
+	ctx, cancelFunc := context.WithCancel(interrupted)
+	// stop ends the commands of every routine when the run duration expires.
+	// Commands in flight still run under ctx and finish.
+	stop, stopFunc := context.WithCancel(ctx)
+	if cfg.Duration > 0 {
+		stop, stopFunc = context.WithTimeout(ctx, cfg.Duration)
+		logs.Printf("run stops after %v", cfg.Duration)
+	}
+	defer stopFunc()
+
+	// Every file is a client, with the id TaskIndex plus its index, queued
+	// for the workers. Generating clients have one worker each.
+	clients := cfg.Routines
+	if cfg.Commands == CommandsFiles {
+		clients = len(cfg.Files)
+	}
+	queue := make(chan int, clients)
+	for i := 0; i < clients; i++ {
+		queue <- i
+	}
+	close(queue)
+
+	var failedClients atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Routines && w < clients; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				clientId := i + cfg.TaskIndex
+				filePath := generatedFile
+				if cfg.Commands == CommandsFiles {
+					filePath = cfg.Files[i]
+				}
+				if stop.Err() != nil {
+					logs.Printf("client #%v not started: %v. file at %s", clientId, stop.Err(), filePath)
+					continue
+				}
+				logs.Printf("starting client #%v", clientId)
+				if err := execute(ctx, stop, clientId, store, cfg, filePath, metricsWriter); err != nil {
+					logs.Printf("client #%v failed: %v", clientId, err)
+					failedClients.Add(1)
+				}
+			}
+		}()
+	}
+
+	compensated := make(chan struct{})
+	if cfg.Compensator.Enabled {
+		go func() {
+			defer close(compensated)
+			Compensate(ctx, store, cfg.Compensator, cfg.Retry.RetryPolicy)
+		}()
+	} else {
+		close(compensated)
+	}
+
+	wg.Wait()
+
+	if cfg.Compensator.Enabled {
+		sleepContext(ctx, cfg.Compensator.Linger)
+	}
+	cancelFunc()
+	<-compensated
+
+	if interrupted.Err() != nil {
+		return fmt.Errorf("interrupted: metrics of the run are incomplete")
+	}
+	if n := failedClients.Load(); n > 0 {
+		return fmt.Errorf("%v of %v clients failed", n, clients)
+	}
+	logs.Printf("all routines joined. run exits normally")
+	return nil
+}
+
+// execute runs the commands of one client until they are exhausted or stop is
+// done, and writes its metrics. It fails when the client cannot start or
+// resume.
+func execute(ctx context.Context, stop context.Context, clientId int, store Store, cfg *Config, filePath string, metricsWriter *MetricsWriter) (err error) {
+	logs := log.New(os.Stdout, fmt.Sprintf("[client #%v] ", clientId), 0)
+	logs.Printf("starts. filePath=%s", filePath)
+
+	defer func() {
+		if r := recover(); r != nil {
+			logs.Printf("recover from panic. Error: \n%v", r)
+			err = fmt.Errorf("panic: %v", r)
+		} else if err == nil {
+			logs.Printf("exits normally")
+		}
+	}()
+
+	source, err := openCommandSource(cfg, clientId, filePath)
+	if err != nil {
+		return fmt.Errorf("open commands failed: %v", err)
+	}
+	defer source.Close()
+
+	metrics := NewClientMetrics(clientId, filePath)
+	window := NewMeasurementWindow(cfg.Measure, metrics)
+	var lastCommitted int64
+	resumed := false
+	if cfg.Checkpoint.Resume {
+		cp, err := metricsWriter.ReadCheckpoint(clientId)
+		if err != nil {
+			return fmt.Errorf("read checkpoint failed: %v", err)
+		}
+		switch {
+		case cp == nil:
+			logs.Printf("no checkpoint, starting from the beginning")
+		case cp.File != filePath || cp.ConfigHash != metricsWriter.ConfigHash:
+			return fmt.Errorf("checkpoint of file %s with config hash %s does not match file %s with config hash %s", cp.File, cp.ConfigHash, filePath, metricsWriter.ConfigHash)
+		case cp.Done:
+			// Write the metrics again, in case the process died before it
+			// did so.
+			logs.Printf("finished before the checkpoint, nothing to resume")
+			metrics = cp.Metrics
+			restoreMeasurementWindow(cfg.Measure, metrics, cp.Window, 0).Finish(cp.Time)
+			return metricsWriter.Write(metrics)
+		default:
+			if err := source.Resume(cp.Progress); err != nil {
+				return fmt.Errorf("resume failed: %v", err)
+			}
+			metrics, window = cp.restore(cfg.Measure)
+			lastCommitted = cp.LastCommitted
+			resumed = true
+			logs.Printf("resuming after line %v, pass %v, %v commands, checkpoint of %v", cp.Progress.Line, cp.Progress.Pass, cp.Progress.Commands, cp.Time.Format(time.RFC3339))
+		}
+	}
+	// progress is where the source was after the last command that finished.
+	// A command taken from the source but cut off by the end of the run is
+	// run again on resume.
+	progress := source.Progress()
+	checkpoint := func(done bool) {
+		cp := &Checkpoint{
+			ClientId:      clientId,
+			File:          filePath,
+			ConfigHash:    metricsWriter.ConfigHash,
+			Time:          time.Now(),
+			Done:          done,
+			Progress:      progress,
+			LastCommitted: lastCommitted,
+			Metrics:       metrics,
+			Window:        window.state(),
+		}
+		if err := metricsWriter.WriteCheckpoint(cp); err != nil {
+			logs.Printf("write checkpoint failed: %v", err)
+		}
+	}
+	lastCheckpoint := time.Now()
+
+	started := time.Now()
+	seed := started.UnixNano() + int64(clientId)
+	pacer := NewPacer(cfg.Pacing, started, seed)
+	thinkRand := rand.New(rand.NewSource(seed))
+	series, err := metricsWriter.OpenTimeSeries(clientId, started, resumed)
+	if err != nil {
+		logs.Printf("open time series failed: %v", err)
+	}
+
+	finished := false
+	for stop.Err() == nil {
+		cmd, err := source.Next()
+		if err == io.EOF {
+			finished = true
+			break
+		} else if perr, ok := err.(*ParseError); ok {
+			logs.Printf("skip malformed command: %v", perr)
+			if perr.Type != "" {
+				end := time.Now()
+				window.Record(perr.Type, OutcomeInvalid, 0, 0, end)
+				if series != nil {
+					series.Record(end, OutcomeInvalid, 0, 0)
+				}
+			} else {
+				metrics.Malformed++
+			}
+			progress = source.Progress()
+			continue
+		} else if err != nil {
+			logs.Printf("read commands failed: %v", err)
+			break
+		}
+
+		times := cfg.Terminal.Times(cmd.Type())
+		if err := sleepContext(stop, times.Keying); err != nil {
+			break
+		}
+
+		// In the open loop, latency counts from the intended start.
+		start := time.Now()
+		if pacer != nil {
+			if start, err = pacer.Wait(stop); err != nil {
+				break
+			}
+		}
+		retry := NewRetrier(cfg.Retry.Policy(cmd.Type()))
+
+		var outcome Outcome
+		switch c := cmd.(type) {
+		case *NewOrderCmd:
+			outcome = NewOrder(ctx, logs, store, retry, c)
+		case *PaymentCmd:
+			outcome = Payment(ctx, logs, store, retry, c)
+		case *DeliveryCmd:
+			outcome = Delivery(ctx, logs, store, retry, c)
+		case *OrderStatusCmd:
+			outcome = OrderStatus(ctx, logs, store, retry, c)
+		case *StockLevelCmd:
+			outcome = StockLevel(ctx, logs, store, retry, c)
+		case *PopularItemCmd:
+			outcome = PopularItem(ctx, logs, store, retry, c)
+		case *TopBalanceCmd:
+			outcome = TopBalance(ctx, logs, store, retry, c)
+		case *RelatedCustomerCmd:
+			outcome = RelatedCustomer(ctx, logs, store, retry, c)
+		}
+
+		if outcome != OutcomeCommitted && ctx.Err() != nil {
+			// Cut off by the shutdown rather than failed on its own.
+			logs.Printf("command %v interrupted: %v. file at %s line %v", cmd.Type(), outcome, filePath, cmd.Line())
+			break
+		}
+		if outcome != OutcomeCommitted {
+			logs.Printf("command %v: %v after %v retries. file at %s line %v", cmd.Type(), outcome, retry.Retries, filePath, cmd.Line())
+		}
+		end := time.Now()
+		window.Record(cmd.Type(), outcome, retry.Retries, end.Sub(start), end)
+		if series != nil {
+			series.Record(end, outcome, retry.Retries, end.Sub(start))
+		}
+		progress = source.Progress()
+		if outcome == OutcomeCommitted {
+			lastCommitted = int64(cmd.Line())
+			if cfg.Commands == CommandsGenerate {
+				lastCommitted = source.Progress().Commands
+			}
+		}
+		if cfg.Checkpoint.Interval > 0 && end.Sub(lastCheckpoint) >= cfg.Checkpoint.Interval {
+			checkpoint(false)
+			lastCheckpoint = end
+		}
+
+		if err := sleepContext(stop, times.ThinkTime(thinkRand)); err != nil {
+			break
+		}
+	}
+
+	if err := stop.Err(); err != nil {
+		logs.Printf("stopped: %v", err)
+	}
+	metrics.Incomplete = ctx.Err() != nil
+	if cfg.Checkpoint.Interval > 0 {
+		// A run stopped by its duration is as finished as one that ran out
+		// of commands.
+		checkpoint(finished || (stop.Err() != nil && !metrics.Incomplete))
+	}
+	end := time.Now()
+	window.Finish(end)
+	if metrics.Warmup > 0 || metrics.Cooldown > 0 {
+		logs.Printf("left out %v warm-up and %v cool-down transactions", metrics.Warmup, metrics.Cooldown)
+	}
+	if series != nil {
+		if err := series.Close(end); err != nil {
+			logs.Printf("write time series failed: %v", err)
+		}
+	}
+	if err := metricsWriter.Write(metrics); err != nil {
+		logs.Printf("%v", err)
+	}
+	return nil
+}
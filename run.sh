@@ -17,5 +17,7 @@ else
 	exit 1
 fi
 
+shift
+
 export GOMAXPROCS=6
-srun $CITUS_EXEC_PATH $@
+srun $CITUS_EXEC_PATH "$@"
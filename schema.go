@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SchemaVersion must be bumped whenever schemaTables or schemaIndexes change,
+// so that binaries built against the old layout refuse the new one.
+const SchemaVersion = 1
+
+type tableDef struct {
+	Name string
+	DDL  string
+	// DistributionColumn is the warehouse id column the table is sharded on.
+	// Empty means the table is replicated to every node.
+	DistributionColumn string
+}
+
+// schemaTables lists the tables in dependency order.
+var schemaTables = []*tableDef{
+	{
+		Name: "warehouse_param",
+		DDL: `CREATE TABLE IF NOT EXISTS warehouse_param (
+			w_id INT NOT NULL,
+			w_ytd DECIMAL(12, 2) NOT NULL,
+			PRIMARY KEY (w_id)
+		)`,
+		DistributionColumn: "w_id",
+	},
+	{
+		Name: "district_info",
+		DDL: `CREATE TABLE IF NOT EXISTS district_info (
+			d_w_id INT NOT NULL,
+			d_id INT NOT NULL,
+			w_name VARCHAR(10),
+			w_street_1 VARCHAR(20),
+			w_street_2 VARCHAR(20),
+			w_city VARCHAR(20),
+			w_state CHAR(2),
+			w_zip CHAR(9),
+			w_tax DECIMAL(4, 4),
+			d_name VARCHAR(10),
+			d_street_1 VARCHAR(20),
+			d_street_2 VARCHAR(20),
+			d_city VARCHAR(20),
+			d_state CHAR(2),
+			d_zip CHAR(9),
+			d_tax DECIMAL(4, 4),
+			PRIMARY KEY (d_w_id, d_id)
+		)`,
+		DistributionColumn: "d_w_id",
+	},
+	{
+		Name: "district_order_id",
+		DDL: `CREATE TABLE IF NOT EXISTS district_order_id (
+			d_w_id INT NOT NULL,
+			d_id INT NOT NULL,
+			d_next_o_id INT NOT NULL,
+			PRIMARY KEY (d_w_id, d_id)
+		)`,
+		DistributionColumn: "d_w_id",
+	},
+	{
+		Name: "district_param",
+		DDL: `CREATE TABLE IF NOT EXISTS district_param (
+			d_w_id INT NOT NULL,
+			d_id INT NOT NULL,
+			d_ytd DECIMAL(12, 2) NOT NULL,
+			PRIMARY KEY (d_w_id, d_id)
+		)`,
+		DistributionColumn: "d_w_id",
+	},
+	{
+		Name: "customer_info",
+		DDL: `CREATE TABLE IF NOT EXISTS customer_info (
+			c_w_id INT NOT NULL,
+			c_d_id INT NOT NULL,
+			c_id INT NOT NULL,
+			c_first VARCHAR(16),
+			c_middle CHAR(2),
+			c_last VARCHAR(16),
+			c_street_1 VARCHAR(20),
+			c_street_2 VARCHAR(20),
+			c_city VARCHAR(20),
+			c_state CHAR(2),
+			c_zip CHAR(9),
+			c_phone CHAR(16),
+			c_since TIMESTAMP,
+			c_credit CHAR(2),
+			c_credit_lim DECIMAL(12, 2),
+			c_discount DECIMAL(5, 4),
+			c_data VARCHAR(500),
+			PRIMARY KEY (c_w_id, c_d_id, c_id)
+		)`,
+		DistributionColumn: "c_w_id",
+	},
+	{
+		Name: "customer_param",
+		DDL: `CREATE TABLE IF NOT EXISTS customer_param (
+			c_w_id INT NOT NULL,
+			c_d_id INT NOT NULL,
+			c_id INT NOT NULL,
+			c_balance DECIMAL(12, 2) NOT NULL,
+			c_ytd_payment DECIMAL(12, 2) NOT NULL,
+			c_payment_cnt INT NOT NULL,
+			c_delivery_cnt INT NOT NULL,
+			c_last_o_id INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (c_w_id, c_d_id, c_id)
+		)`,
+		DistributionColumn: "c_w_id",
+	},
+	{
+		Name: "items",
+		DDL: `CREATE TABLE IF NOT EXISTS items (
+			i_id INT NOT NULL,
+			i_name VARCHAR(24),
+			i_price DECIMAL(5, 2),
+			i_im_id INT,
+			i_data VARCHAR(50),
+			PRIMARY KEY (i_id)
+		)`,
+	},
+	{
+		Name: "stocks",
+		DDL: `CREATE TABLE IF NOT EXISTS stocks (
+			s_w_id INT NOT NULL,
+			s_i_id INT NOT NULL,
+			s_qty INT NOT NULL,
+			s_ytd DECIMAL(8, 2) NOT NULL,
+			s_order_cnt INT NOT NULL,
+			s_remote_cnt INT NOT NULL,
+			PRIMARY KEY (s_w_id, s_i_id)
+		)`,
+		DistributionColumn: "s_w_id",
+	},
+	{
+		Name: "stock_info_by_district",
+		DDL: `CREATE TABLE IF NOT EXISTS stock_info_by_district (
+			s_w_id INT NOT NULL,
+			s_i_id INT NOT NULL,
+			s_dist_01 CHAR(24),
+			s_dist_02 CHAR(24),
+			s_dist_03 CHAR(24),
+			s_dist_04 CHAR(24),
+			s_dist_05 CHAR(24),
+			s_dist_06 CHAR(24),
+			s_dist_07 CHAR(24),
+			s_dist_08 CHAR(24),
+			s_dist_09 CHAR(24),
+			s_dist_10 CHAR(24),
+			s_data VARCHAR(50),
+			PRIMARY KEY (s_w_id, s_i_id)
+		)`,
+		DistributionColumn: "s_w_id",
+	},
+	{
+		Name: "orders",
+		DDL: `CREATE TABLE IF NOT EXISTS orders (
+			o_w_id INT NOT NULL,
+			o_d_id INT NOT NULL,
+			o_id INT NOT NULL,
+			o_c_id INT NOT NULL,
+			o_carrier_id INT,
+			o_ol_cnt INT NOT NULL,
+			o_all_local BOOLEAN NOT NULL,
+			o_entry_d TIMESTAMP NOT NULL,
+			PRIMARY KEY (o_w_id, o_d_id, o_id)
+		)`,
+		DistributionColumn: "o_w_id",
+	},
+	{
+		Name: "order_lines",
+		DDL: `CREATE TABLE IF NOT EXISTS order_lines (
+			ol_w_id INT NOT NULL,
+			ol_d_id INT NOT NULL,
+			ol_o_id INT NOT NULL,
+			ol_number INT NOT NULL,
+			ol_i_id INT NOT NULL,
+			ol_i_name VARCHAR(24),
+			ol_delivery_d TIMESTAMP,
+			ol_amount DECIMAL(7, 2) NOT NULL,
+			ol_supply_w_id INT NOT NULL,
+			ol_quantity INT NOT NULL,
+			ol_dist_info CHAR(24),
+			PRIMARY KEY (ol_w_id, ol_d_id, ol_o_id, ol_number)
+		)`,
+		DistributionColumn: "ol_w_id",
+	},
+	{
+		Name: "payment_history",
+		DDL: `CREATE TABLE IF NOT EXISTS payment_history (
+			id UUID NOT NULL,
+			w_id INT NOT NULL,
+			d_id INT NOT NULL,
+			c_id INT NOT NULL,
+			amount DECIMAL(6, 2) NOT NULL,
+			is_w_ytd_updated SMALLINT NOT NULL DEFAULT 0,
+			is_d_ytd_updated SMALLINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT (clock_timestamp() AT TIME ZONE 'UTC'),
+			PRIMARY KEY (w_id, d_id, id)
+		)`,
+		DistributionColumn: "w_id",
+	},
+	{
+		Name: "payment_pointer",
+		DDL: `CREATE TABLE IF NOT EXISTS payment_pointer (
+			w_id INT NOT NULL,
+			d_id INT NOT NULL,
+			pointer TIMESTAMP NOT NULL,
+			PRIMARY KEY (w_id, d_id)
+		)`,
+		DistributionColumn: "w_id",
+	},
+	{
+		Name: "delivery_cursor",
+		DDL: `CREATE TABLE IF NOT EXISTS delivery_cursor (
+			w_id INT NOT NULL,
+			d_id INT NOT NULL,
+			next_delivery_o_id INT NOT NULL,
+			PRIMARY KEY (w_id, d_id)
+		)`,
+		DistributionColumn: "w_id",
+	},
+}
+
+var schemaIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS customer_param_balance_idx ON customer_param (c_w_id, c_balance DESC)`,
+	`CREATE INDEX IF NOT EXISTS orders_customer_idx ON orders (o_w_id, o_d_id, o_c_id)`,
+	`CREATE INDEX IF NOT EXISTS order_lines_item_idx ON order_lines (ol_i_id)`,
+	`CREATE INDEX IF NOT EXISTS stocks_qty_idx ON stocks (s_w_id, s_qty)`,
+	`CREATE INDEX IF NOT EXISTS payment_history_created_at_idx ON payment_history (w_id, d_id, created_at)`,
+}
+
+// colocationTable anchors the co-location group every distributed table joins.
+const colocationTable = "warehouse_param"
+
+// CreateSchema creates every table and index, distributes them when citus is
+// set and records SchemaVersion. drop removes existing tables and their data
+// first.
+func CreateSchema(db *gorm.DB, citus bool, drop bool) error {
+	if drop {
+		if err := DropSchema(db); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'UTC')
+	)`).Error; err != nil {
+		return fmt.Errorf("create schema_version failed: %v", err)
+	}
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version == SchemaVersion {
+		logs.Printf("schema is already at version %v", version)
+		return nil
+	} else if version != 0 {
+		return fmt.Errorf("database has schema version %v, this binary creates version %v; run schema recreate", version, SchemaVersion)
+	}
+
+	for _, t := range schemaTables {
+		if err := db.Exec(t.DDL).Error; err != nil {
+			return fmt.Errorf("create table %s failed: %v", t.Name, err)
+		}
+	}
+	for _, ddl := range schemaIndexes {
+		if err := db.Exec(ddl).Error; err != nil {
+			return fmt.Errorf("create index failed: %v. ddl=%s", err, ddl)
+		}
+	}
+
+	if citus {
+		if err := distributeTables(db); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Exec(`INSERT INTO schema_version(version) VALUES (?)`, SchemaVersion).Error; err != nil {
+		return fmt.Errorf("record schema version failed: %v", err)
+	}
+	logs.Printf("created schema version %v", SchemaVersion)
+	return nil
+}
+
+func distributeTables(db *gorm.DB) error {
+	for _, t := range schemaTables {
+		var q string
+		var args []interface{}
+		if t.DistributionColumn == "" {
+			q = `SELECT create_reference_table(?)`
+			args = []interface{}{t.Name}
+		} else if t.Name == colocationTable {
+			q = `SELECT create_distributed_table(?, ?)`
+			args = []interface{}{t.Name, t.DistributionColumn}
+		} else {
+			q = `SELECT create_distributed_table(?, ?, colocate_with => ?)`
+			args = []interface{}{t.Name, t.DistributionColumn, colocationTable}
+		}
+		if err := db.Exec(q, args...).Error; err != nil {
+			return fmt.Errorf("distribute table %s failed: %v", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func DropSchema(db *gorm.DB) error {
+	for i := len(schemaTables) - 1; i >= 0; i-- {
+		t := schemaTables[i]
+		if err := db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, t.Name)).Error; err != nil {
+			return fmt.Errorf("drop table %s failed: %v", t.Name, err)
+		}
+	}
+	if err := db.Exec(`DROP TABLE IF EXISTS schema_version`).Error; err != nil {
+		return fmt.Errorf("drop table schema_version failed: %v", err)
+	}
+	return nil
+}
+
+// getSchemaVersion returns 0 for a database without a recorded version.
+func getSchemaVersion(db *gorm.DB) (int, error) {
+	var exists bool
+	if err := db.Raw(`SELECT to_regclass('schema_version') IS NOT NULL`).Row().Scan(&exists); err != nil {
+		return 0, fmt.Errorf("look up schema_version failed: %v", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err := db.Raw(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Row().Scan(&version); err != nil {
+		return 0, fmt.Errorf("get schema version failed: %v", err)
+	}
+	return version, nil
+}
+
+// CheckSchemaVersion fails unless the database was created by this binary's
+// schema version.
+func CheckSchemaVersion(db *gorm.DB) error {
+	version, err := getSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return fmt.Errorf("database has no schema; create it with the schema command")
+	} else if version != SchemaVersion {
+		return fmt.Errorf("schema version mismatch: database has %v, binary expects %v", version, SchemaVersion)
+	}
+	return nil
+}
+
+// schemaCommand runs "schema create", "schema recreate", "schema drop" or
+// "schema version".
+func schemaCommand(cfg *Config, args []string) error {
+	action := "create"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	db, err := OpenDB(&cfg.DB)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "create":
+		return CreateSchema(db, cfg.DB.Citus, false)
+	case "recreate":
+		return CreateSchema(db, cfg.DB.Citus, true)
+	case "drop":
+		return DropSchema(db)
+	case "version":
+		version, err := getSchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		logs.Printf("database schema version: %v, binary schema version: %v", version, SchemaVersion)
+		return nil
+	default:
+		return fmt.Errorf("unknown schema action %q", action)
+	}
+}
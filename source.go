@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Where the commands of a run come from.
+const (
+	CommandsFiles    = "files"
+	CommandsGenerate = "generate"
+)
+
+// CommandSource yields the commands of one client, like Parser.
+type CommandSource interface {
+	// Next returns the next command, io.EOF after the last one, or a
+	// *ParseError for a malformed command.
+	Next() (TxnCommand, error)
+	// Progress tells how far the source has been read.
+	Progress() Progress
+	// Resume skips what was read up to p, on a freshly opened source.
+	Resume(p Progress) error
+	Close() error
+}
+
+// Progress is a position in a command source: the pass over the file and the
+// lines of it consumed, and the commands read so far over all passes.
+type Progress struct {
+	Pass     int   `json:"pass"`
+	Line     int   `json:"line"`
+	Commands int64 `json:"commands"`
+}
+
+// fileSource reads a transaction file, starting over at its end when loop is
+// set.
+type fileSource struct {
+	path   string
+	loop   bool
+	file   *os.File
+	parser *Parser
+	pass   int
+	// read counts the commands of the current pass. A file without any is
+	// not looped.
+	read     int
+	commands int64
+}
+
+func openFileSource(path string, loop bool) (*fileSource, error) {
+	s := &fileSource{path: path, loop: loop}
+	return s, s.open()
+}
+
+func (s *fileSource) open() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.parser = NewParser(file, s.path)
+	s.read = 0
+	return nil
+}
+
+func (s *fileSource) Next() (TxnCommand, error) {
+	cmd, err := s.parser.Next()
+	if err == io.EOF && s.loop && s.read > 0 {
+		s.file.Close()
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+		s.pass++
+		cmd, err = s.parser.Next()
+	}
+	if err == nil {
+		s.read++
+		s.commands++
+	}
+	return cmd, err
+}
+
+func (s *fileSource) Progress() Progress {
+	return Progress{Pass: s.pass, Line: s.parser.line, Commands: s.commands}
+}
+
+func (s *fileSource) Resume(p Progress) error {
+	if p.Pass > 0 && !s.loop {
+		return fmt.Errorf("%s was looped %v times, but the run has no duration", s.path, p.Pass)
+	}
+	s.parser.skip(p.Line)
+	if s.parser.line < p.Line {
+		return fmt.Errorf("%s has %v lines, expected at least %v", s.path, s.parser.line, p.Line)
+	}
+	s.pass = p.Pass
+	s.commands = p.Commands
+	if p.Commands > 0 {
+		s.read = 1
+	}
+	return nil
+}
+
+func (s *fileSource) Close() error {
+	return s.file.Close()
+}
+
+// genSource generates an endless stream of commands shaped by the gen
+// section, or gen.transactions commands when limited.
+type genSource struct {
+	gen       *TxnGenerator
+	limited   bool
+	left      int
+	generated int64
+}
+
+// generatedFile names the source of generated commands in metrics and parse
+// errors.
+const generatedFile = "generated"
+
+func newGenSource(cfg *Config, seed int64, limited bool) (*genSource, error) {
+	gen, err := NewTxnGenerator(&cfg.Gen, cfg.DataGen.Warehouses, seed)
+	if err != nil {
+		return nil, err
+	}
+	return &genSource{gen: gen, limited: limited, left: cfg.Gen.Transactions}, nil
+}
+
+func (s *genSource) Next() (TxnCommand, error) {
+	if s.limited {
+		if s.left <= 0 {
+			return nil, io.EOF
+		}
+		s.left--
+	}
+	lines := s.gen.command(s.gen.nextType())
+	s.generated++
+	return NewParser(strings.NewReader(strings.Join(lines, "\n")), generatedFile).Next()
+}
+
+func (s *genSource) Progress() Progress {
+	return Progress{Commands: s.generated}
+}
+
+// Resume generates and drops the commands already read, so that the source
+// continues with the same commands as before.
+func (s *genSource) Resume(p Progress) error {
+	for s.generated < p.Commands {
+		if s.limited {
+			if s.left <= 0 {
+				return fmt.Errorf("checkpoint is past gen.transactions %v", s.gen.cfg.Transactions)
+			}
+			s.left--
+		}
+		s.gen.command(s.gen.nextType())
+		s.generated++
+	}
+	return nil
+}
+
+func (s *genSource) Close() error {
+	return nil
+}
+
+// openCommandSource opens the commands of the client clientId reading
+// path. Files are looped and generated commands are endless in runs bounded
+// by a duration.
+func openCommandSource(cfg *Config, clientId int, path string) (CommandSource, error) {
+	switch cfg.Commands {
+	case CommandsGenerate:
+		// Seeded by client so that reruns issue the same commands.
+		return newGenSource(cfg, cfg.DataGen.Seed+int64(clientId), cfg.Duration <= 0)
+	case CommandsFiles:
+		return openFileSource(path, cfg.Duration > 0)
+	default:
+		return nil, fmt.Errorf("unknown commands source %q", cfg.Commands)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Store is the data access layer the transaction handlers are written
+// against. Every method is one unit of work: methods that write more than one
+// row do so atomically, so a handler can retry a failed call as a whole.
+//
+// Lookups of a single row return sql.ErrNoRows when the row does not exist.
+type Store interface {
+	GetDistrictIds(ctx context.Context, wid int64) ([]int64, error)
+	GetDistricts(ctx context.Context) ([]*DistrictInfo, error)
+	GetDistrictInfo(ctx context.Context, wid, did int64) (*DistrictInfo, error)
+	GetNextOrderId(ctx context.Context, wid, did int64) (int64, error)
+	// AllocateOrderId returns the district's next order id and advances it.
+	AllocateOrderId(ctx context.Context, wid, did int64) (int64, error)
+
+	GetCustomerInfo(ctx context.Context, wid, did, cid int64) (*CustomerInfo, error)
+	GetCustomerParam(ctx context.Context, wid, did, cid int64) (*CustomerParam, error)
+	// GetTopBalanceCustomers reads the limit customers with the highest
+	// balance of every warehouse of wids, in one transaction.
+	GetTopBalanceCustomers(ctx context.Context, wids []int64, limit int) ([]*CustomerParam, error)
+
+	GetItem(ctx context.Context, iid int64) (*Item, error)
+	GetItemNames(ctx context.Context, iids []int64) (map[int64]string, error)
+
+	GetStock(ctx context.Context, wid, iid int64) (*Stock, error)
+	GetStockDistInfo(ctx context.Context, wid, iid, did int64) (string, error)
+	CountStocksBelow(ctx context.Context, wid int64, iids []int64, threshold int64) (int64, error)
+	// ApplyStockDeltas adds every delta to its stock row.
+	ApplyStockDeltas(ctx context.Context, deltas []*StockDelta) error
+	// UpdateStocks reads the stock row of every key in turn and applies the
+	// delta update returns for it, all in one transaction.
+	UpdateStocks(ctx context.Context, keys []*StockKey, update func(stock *Stock) *StockDelta) error
+	// CountLowStocks counts the distinct items of the last l orders of the
+	// district whose stock is below threshold, reading in one transaction.
+	CountLowStocks(ctx context.Context, wid, did, l, threshold int64) (int64, error)
+
+	// InsertOrder inserts the order with its lines and makes it the
+	// customer's last order.
+	InsertOrder(ctx context.Context, order *Order, lines []*Orderline) error
+	GetOrder(ctx context.Context, wid, did, oid int64) (*Order, error)
+	GetOrderCustomerId(ctx context.Context, wid, did, oid int64) (int64, error)
+	GetCustomerOrderIds(ctx context.Context, wid, did, cid int64) ([]int64, error)
+	GetOrdersFrom(ctx context.Context, wid, did, fromOid int64) ([]*Order, error)
+	GetOrderlines(ctx context.Context, wid, did, oid int64) ([]*Orderline, error)
+	// GetLastOrder reads the customer, its last order and the order's lines
+	// in one transaction.
+	GetLastOrder(ctx context.Context, wid, did, cid int64) (*CustomerParam, *Order, []*Orderline, error)
+	GetOrderlinesFrom(ctx context.Context, wid, did, fromOid int64) ([]*Orderline, error)
+	// GetOrdersWithLinesFrom reads the orders from fromOid on and their lines
+	// in one transaction.
+	GetOrdersWithLinesFrom(ctx context.Context, wid, did, fromOid int64) ([]*Order, []*Orderline, error)
+	GetOrderlineItemIds(ctx context.Context, wid, did, fromOid, toOid int64) ([]int64, error)
+	// GetOrdersSharingItems returns the orders outside warehouse excludeWid
+	// that contain at least minShared of iids.
+	GetOrdersSharingItems(ctx context.Context, excludeWid int64, iids []int64, minShared int) ([]*CommonOrder, error)
+
+	GetDeliveryCursor(ctx context.Context, wid, did int64) (int64, error)
+	// DeliverOrder assigns the carrier, stamps the order lines, advances the
+	// delivery cursor and charges the customer. It returns false without
+	// changes when the order was already delivered.
+	DeliverOrder(ctx context.Context, wid, did, oid, cid, carrierId int64) (bool, error)
+
+	// ApplyCustomerPayment charges the customer and records the payment in
+	// payment_history, returning the payment id and the new balance.
+	ApplyCustomerPayment(ctx context.Context, wid, did, cid int64, amount float64) (string, float64, error)
+	ApplyWarehousePayment(ctx context.Context, paymentId string, wid, did, cid int64, amount float64) error
+	ApplyDistrictPayment(ctx context.Context, paymentId string, wid, did, cid int64, amount float64) error
+
+	GetPaymentPointers(ctx context.Context) ([]*PaymentPointer, error)
+	// CompensatePayments applies up to limit payments after ptr that missed
+	// their w_ytd or d_ytd update and advances the pointer. It reports
+	// whether any ytd changed.
+	CompensatePayments(ctx context.Context, ptr *PaymentPointer, limit int) (bool, error)
+
+	// GetDBState sums up the whole database. The tables are read one after
+	// the other, so it is only consistent while no transaction runs.
+	GetDBState(ctx context.Context) (*DBState, error)
+	// GetWarehouseYtds returns w_ytd by warehouse.
+	GetWarehouseYtds(ctx context.Context) (map[int64]float64, error)
+	// GetDistrictStates evaluates the per district consistency conditions.
+	GetDistrictStates(ctx context.Context) ([]*DistrictState, error)
+}
+
+// OpenStore returns the store of cfg.Backend. The memory backend is populated
+// from the load section first, so a run against it needs no database.
+func OpenStore(cfg *Config) (Store, error) {
+	switch cfg.Backend {
+	case BackendMemory:
+		open, err := dataOpener(cfg, cfg.Load.DataDir)
+		if err != nil {
+			return nil, fmt.Errorf("memory backend: %v", err)
+		}
+		store := NewMemoryStore()
+		start := time.Now()
+		if err := NewLoader(open, store).Load(context.Background()); err != nil {
+			return nil, err
+		}
+		logs.Printf("memory backend populated in %v", time.Since(start).Round(time.Millisecond))
+		return store, nil
+	default:
+		db, err := OpenDB(&cfg.DB)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckSchemaVersion(db); err != nil {
+			return nil, err
+		}
+		return NewCitusStore(db), nil
+	}
+}
@@ -0,0 +1,964 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CitusStore implements Store with the SQL of the project's Citus schema.
+type CitusStore struct {
+	db *gorm.DB
+}
+
+func NewCitusStore(db *gorm.DB) *CitusStore {
+	return &CitusStore{db: db}
+}
+
+// inTx runs fn against a store whose statements all run in one transaction.
+func (s *CitusStore) inTx(ctx context.Context, fn func(tx *CitusStore) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&CitusStore{db: tx})
+	})
+}
+
+func (s *CitusStore) GetDistrictIds(ctx context.Context, wid int64) ([]int64, error) {
+	dids := make([]int64, 0)
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT d_id
+		FROM district_info
+		WHERE d_w_id = ?
+		LIMIT 10000
+	`, wid).Scan(&dids).Error
+	return dids, err
+}
+
+func (s *CitusStore) GetDistricts(ctx context.Context) ([]*DistrictInfo, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		select d_id, d_w_id, w_name, d_name
+		from district_info
+		LIMIT 10000
+	`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	districts := make([]*DistrictInfo, 0)
+	for rows.Next() {
+		d := &DistrictInfo{}
+		if err := rows.Scan(&d.DId, &d.DWId, &d.WName, &d.DName); err != nil {
+			return nil, err
+		}
+		districts = append(districts, d)
+	}
+	return districts, rows.Err()
+}
+
+func (s *CitusStore) GetDistrictInfo(ctx context.Context, wid, did int64) (*DistrictInfo, error) {
+	di := &DistrictInfo{}
+	row := s.db.WithContext(ctx).Raw(`
+		SELECT d_id, d_w_id, w_name, w_street_1, w_street_2, w_city, w_state, w_zip, w_tax, d_name, d_street_1, d_street_2, d_city, d_state, d_zip, d_tax
+		FROM district_info
+		WHERE d_w_id = ? AND d_id = ?
+		LIMIT 1
+	`, wid, did).Row()
+	if err := row.Scan(&di.DId, &di.DWId, &di.WName, &di.WStreet1, &di.WStreet2, &di.WCity, &di.WState, &di.WZip, &di.WTax, &di.DName, &di.DStreet1, &di.DStreet2, &di.DCity, &di.DState, &di.DZip, &di.DTax); err != nil {
+		return nil, err
+	}
+	return di, nil
+}
+
+func (s *CitusStore) GetNextOrderId(ctx context.Context, wid, did int64) (int64, error) {
+	var nextOrderId int64
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT d_next_o_id
+		FROM district_order_id
+		WHERE d_w_id = ? AND d_id = ?
+		LIMIT 1
+	`, wid, did).Row().Scan(&nextOrderId)
+	return nextOrderId, err
+}
+
+func (s *CitusStore) AllocateOrderId(ctx context.Context, wid, did int64) (int64, error) {
+	var nextOrderId int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(`
+			SELECT d_next_o_id
+			FROM district_order_id
+			WHERE d_id = ? AND d_w_id = ?
+			LIMIT 1`, did, wid).Row().Scan(&nextOrderId); err != nil {
+			return err
+		}
+
+		tx = tx.Exec(`
+			UPDATE district_order_id
+			SET d_next_o_id = ?
+			WHERE d_id = ? AND d_w_id = ?
+		`, nextOrderId+1, did, wid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+		return nil
+	})
+	return nextOrderId, err
+}
+
+func (s *CitusStore) GetCustomerInfo(ctx context.Context, wid, did, cid int64) (*CustomerInfo, error) {
+	ci := &CustomerInfo{}
+	row := s.db.WithContext(ctx).Raw(`
+		SELECT c_w_id, c_d_id, c_id, c_first, c_middle, c_last, c_street_1, c_street_2, c_city, c_state, c_zip, c_phone, c_since, c_credit, c_credit_lim, c_discount, c_data
+		FROM customer_info
+		WHERE c_w_id = ? AND c_d_id = ? AND c_id = ?
+		LIMIT 1
+	`, wid, did, cid).Row()
+	if err := row.Scan(&ci.CWId, &ci.CDId, &ci.CId, &ci.CFirst, &ci.CMiddle, &ci.CLast, &ci.CStreet1, &ci.CStreet2, &ci.CCity, &ci.CState, &ci.CZip, &ci.CPhone, &ci.CSince, &ci.CCredit, &ci.CCreditLim, &ci.CDiscount, &ci.CData); err != nil {
+		return nil, err
+	}
+	return ci, nil
+}
+
+func (s *CitusStore) GetCustomerParam(ctx context.Context, wid, did, cid int64) (*CustomerParam, error) {
+	cp := &CustomerParam{}
+	row := s.db.WithContext(ctx).Raw(`
+		SELECT c_w_id, c_d_id, c_id, c_balance, c_ytd_payment, c_payment_cnt, c_delivery_cnt, c_last_o_id
+		FROM customer_param
+		WHERE c_w_id = ? AND c_d_id = ? AND c_id = ?
+		LIMIT 1
+	`, wid, did, cid).Row()
+	if err := row.Scan(&cp.CWId, &cp.CDId, &cp.CId, &cp.CBalance, &cp.CYtdPayment, &cp.CPaymentCnt, &cp.CDeliveryCnt, &cp.CLastOId); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (s *CitusStore) GetTopBalanceCustomers(ctx context.Context, wids []int64, limit int) ([]*CustomerParam, error) {
+	customers := make([]*CustomerParam, 0)
+	err := s.inTx(ctx, func(tx *CitusStore) error {
+		for _, wid := range wids {
+			top, err := tx.topBalanceCustomers(ctx, wid, limit)
+			if err != nil {
+				return err
+			}
+			customers = append(customers, top...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+func (s *CitusStore) topBalanceCustomers(ctx context.Context, wid int64, limit int) ([]*CustomerParam, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		select c_w_id, c_d_id, c_id, c_balance
+		from customer_param
+		where c_w_id = ?
+		order by c_balance desc
+		limit ?
+	`, wid, limit).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := make([]*CustomerParam, 0)
+	for rows.Next() {
+		c := &CustomerParam{}
+		if err := rows.Scan(&c.CWId, &c.CDId, &c.CId, &c.CBalance); err != nil {
+			return nil, err
+		}
+		customers = append(customers, c)
+	}
+	return customers, rows.Err()
+}
+
+func (s *CitusStore) GetItem(ctx context.Context, iid int64) (*Item, error) {
+	item := &Item{IId: iid}
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT i_price, i_name FROM items
+		WHERE i_id = ?
+		LIMIT 1
+	`, iid).Row().Scan(&item.IPrice, &item.IName)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *CitusStore) GetItemNames(ctx context.Context, iids []int64) (map[int64]string, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		select i_id, i_name
+		from items
+		where i_id in ?
+	`, iids).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int64]string, 0)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
+
+func (s *CitusStore) GetStock(ctx context.Context, wid, iid int64) (*Stock, error) {
+	stock := &Stock{SWId: wid, SIId: iid}
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT s_qty, s_ytd, s_order_cnt, s_remote_cnt
+		FROM stocks
+		WHERE s_w_id = ? AND s_i_id = ?
+		LIMIT 1`, wid, iid).Row().Scan(&stock.SQty, &stock.SYtd, &stock.SOrderCnt, &stock.SRemoteCnt)
+	if err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+func (s *CitusStore) GetStockDistInfo(ctx context.Context, wid, iid, did int64) (string, error) {
+	q := fmt.Sprintf("SELECT s_dist_%02d FROM stock_info_by_district WHERE s_w_id = ? AND s_i_id = ? LIMIT 1", did)
+	var distInfo string
+	err := s.db.WithContext(ctx).Raw(q, wid, iid).Row().Scan(&distInfo)
+	return distInfo, err
+}
+
+func (s *CitusStore) CountStocksBelow(ctx context.Context, wid int64, iids []int64, threshold int64) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Raw(`
+		select count(*)
+		from stocks
+		where s_w_id=? and s_qty < ? and s_i_id in ?
+	`, wid, threshold, iids).Row().Scan(&count)
+	return count, err
+}
+
+func (s *CitusStore) ApplyStockDeltas(ctx context.Context, deltas []*StockDelta) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, d := range deltas {
+			tx = tx.Exec(`
+				UPDATE stocks
+				SET s_qty = s_qty + ?, s_ytd = s_ytd + ?, s_order_cnt = s_order_cnt + ?, s_remote_cnt = s_remote_cnt + ?
+				WHERE s_w_id = ? AND s_i_id = ?
+			`, d.Quantity, d.Ytd, d.OrderCount, d.RemoteCount, d.SupplyWid, d.ItemId)
+			if tx.Error != nil {
+				return tx.Error
+			} else if tx.RowsAffected == 0 {
+				return ErrNoRowsAffected
+			}
+		}
+		return nil
+	})
+}
+
+func (s *CitusStore) UpdateStocks(ctx context.Context, keys []*StockKey, update func(stock *Stock) *StockDelta) error {
+	return s.inTx(ctx, func(tx *CitusStore) error {
+		for _, k := range keys {
+			stock, err := tx.GetStock(ctx, k.Wid, k.Iid)
+			if err != nil {
+				return err
+			}
+			if err := tx.ApplyStockDeltas(ctx, []*StockDelta{update(stock)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *CitusStore) CountLowStocks(ctx context.Context, wid, did, l, threshold int64) (int64, error) {
+	var count int64
+	err := s.inTx(ctx, func(tx *CitusStore) error {
+		nextOrderId, err := tx.GetNextOrderId(ctx, wid, did)
+		if err != nil {
+			return err
+		}
+		itemIds, err := tx.GetOrderlineItemIds(ctx, wid, did, nextOrderId-l, nextOrderId-1)
+		if err != nil {
+			return err
+		}
+		count, err = tx.CountStocksBelow(ctx, wid, itemIds, threshold)
+		return err
+	})
+	return count, err
+}
+
+func (s *CitusStore) InsertOrder(ctx context.Context, order *Order, lines []*Orderline) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Exec(`
+			INSERT INTO orders(o_w_id, o_d_id, o_id, o_c_id, o_carrier_id, o_ol_cnt, o_all_local, o_entry_d) VALUES
+			(?, ?, ?, ?, NULL, ?, ?, ?)
+		`, order.OWId, order.ODId, order.OId, order.OCId, order.OOlCnt, order.OAllLocal, order.OEntryD)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		tx = tx.Exec(`
+			UPDATE customer_param
+			SET c_last_o_id = ?
+			WHERE c_w_id = ? AND c_d_id = ? AND c_id = ? AND c_last_o_id < ?
+		`, order.OId, order.OWId, order.ODId, order.OCId, order.OId)
+		if tx.Error != nil {
+			return tx.Error
+		}
+
+		for _, ol := range lines {
+			tx = tx.Exec(`
+				INSERT INTO order_lines(ol_w_id, ol_d_id, ol_o_id, ol_number, ol_i_id, ol_i_name,
+					ol_delivery_d, ol_amount, ol_supply_w_id, ol_quantity, ol_dist_info) VALUES
+					(?, ?, ?, ?, ?, ?,
+					NULL, ?, ?, ?, ?)
+			`, ol.OlWId, ol.OlDId, ol.OlOId, ol.OlNumber, ol.OlIId, ol.OlIName, ol.OlAmount, ol.OlSupplyWId, ol.OlQuantity, ol.OlDistInfo)
+			if tx.Error != nil {
+				return tx.Error
+			} else if tx.RowsAffected == 0 {
+				return ErrNoRowsAffected
+			}
+		}
+		return nil
+	})
+}
+
+func (s *CitusStore) GetOrder(ctx context.Context, wid, did, oid int64) (*Order, error) {
+	o := &Order{OWId: wid, ODId: did, OId: oid}
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT o_c_id, COALESCE(o_carrier_id, -1), o_ol_cnt, o_all_local, o_entry_d
+		FROM orders
+		WHERE o_w_id = ? AND o_d_id = ? AND o_id = ?
+		LIMIT 1
+	`, wid, did, oid).Row().Scan(&o.OCId, &o.OCarrierId, &o.OOlCnt, &o.OAllLocal, &o.OEntryD)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (s *CitusStore) GetOrderCustomerId(ctx context.Context, wid, did, oid int64) (int64, error) {
+	var cid int64
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT o_c_id
+		FROM orders
+		WHERE o_w_id = ? AND o_d_id = ? AND o_id = ?
+		LIMIT 1
+	`, wid, did, oid).Row().Scan(&cid)
+	return cid, err
+}
+
+func (s *CitusStore) GetCustomerOrderIds(ctx context.Context, wid, did, cid int64) ([]int64, error) {
+	oids := make([]int64, 0)
+	err := s.db.WithContext(ctx).Raw(`
+		select o_id
+		from orders
+		where o_w_id = ? and o_d_id = ? and o_c_id = ?
+		LIMIT 10000
+	`, wid, did, cid).Scan(&oids).Error
+	return oids, err
+}
+
+func (s *CitusStore) GetOrdersFrom(ctx context.Context, wid, did, fromOid int64) ([]*Order, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		select o_id, o_c_id, o_entry_d
+		from orders
+		where o_w_id=? and o_d_id=? and o_id >= ?
+	`, wid, did, fromOid).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*Order, 0)
+	for rows.Next() {
+		o := &Order{OWId: wid, ODId: did}
+		if err := rows.Scan(&o.OId, &o.OCId, &o.OEntryD); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (s *CitusStore) GetOrderlines(ctx context.Context, wid, did, oid int64) ([]*Orderline, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		SELECT ol_number, ol_i_id, COALESCE(ol_delivery_d, '0001-01-01 00:00:00'), ol_amount, ol_supply_w_id, ol_quantity
+		FROM order_lines
+		WHERE ol_w_id = ? AND ol_d_id = ? AND ol_o_id = ?
+	`, wid, did, oid).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]*Orderline, 0)
+	for rows.Next() {
+		ol := &Orderline{OlWId: wid, OlDId: did, OlOId: oid}
+		if err := rows.Scan(&ol.OlNumber, &ol.OlIId, &ol.OlDeliveryD, &ol.OlAmount, &ol.OlSupplyWId, &ol.OlQuantity); err != nil {
+			return nil, err
+		}
+		lines = append(lines, ol)
+	}
+	return lines, rows.Err()
+}
+
+func (s *CitusStore) GetLastOrder(ctx context.Context, wid, did, cid int64) (*CustomerParam, *Order, []*Orderline, error) {
+	var cp *CustomerParam
+	var order *Order
+	var lines []*Orderline
+	err := s.inTx(ctx, func(tx *CitusStore) (err error) {
+		if cp, err = tx.GetCustomerParam(ctx, wid, did, cid); err != nil {
+			return err
+		}
+		if order, err = tx.GetOrder(ctx, wid, did, cp.CLastOId); err != nil {
+			return err
+		}
+		lines, err = tx.GetOrderlines(ctx, wid, did, cp.CLastOId)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cp, order, lines, nil
+}
+
+func (s *CitusStore) GetOrderlinesFrom(ctx context.Context, wid, did, fromOid int64) ([]*Orderline, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		select ol_o_id, ol_i_id, ol_quantity
+		from order_lines
+		where ol_w_id = ? and ol_d_id = ? and ol_o_id >= ?
+	`, wid, did, fromOid).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]*Orderline, 0)
+	for rows.Next() {
+		ol := &Orderline{OlWId: wid, OlDId: did}
+		if err := rows.Scan(&ol.OlOId, &ol.OlIId, &ol.OlQuantity); err != nil {
+			return nil, err
+		}
+		lines = append(lines, ol)
+	}
+	return lines, rows.Err()
+}
+
+func (s *CitusStore) GetOrdersWithLinesFrom(ctx context.Context, wid, did, fromOid int64) ([]*Order, []*Orderline, error) {
+	var orders []*Order
+	var lines []*Orderline
+	err := s.inTx(ctx, func(tx *CitusStore) (err error) {
+		if orders, err = tx.GetOrdersFrom(ctx, wid, did, fromOid); err != nil {
+			return err
+		}
+		lines, err = tx.GetOrderlinesFrom(ctx, wid, did, fromOid)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return orders, lines, nil
+}
+
+func (s *CitusStore) GetOrderlineItemIds(ctx context.Context, wid, did, fromOid, toOid int64) ([]int64, error) {
+	itemIds := make([]int64, 0)
+	err := s.db.WithContext(ctx).Raw(`
+		select ol_i_id
+		from order_lines
+		where ol_w_id=? and ol_d_id = ? and ol_o_id between ? and ?
+	`, wid, did, fromOid, toOid).Scan(&itemIds).Error
+	return itemIds, err
+}
+
+func (s *CitusStore) GetOrdersSharingItems(ctx context.Context, excludeWid int64, iids []int64, minShared int) ([]*CommonOrder, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		select ol_w_id, ol_d_id, ol_o_id
+		from order_lines
+		where ol_w_id != ? and ol_i_id in (?)
+		group by ol_w_id, ol_d_id, ol_o_id
+		having count(ol_i_id) >= ?
+	`, excludeWid, iids, minShared).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commonOrders := make([]*CommonOrder, 0)
+	for rows.Next() {
+		co := &CommonOrder{}
+		if err := rows.Scan(&co.Wid, &co.Did, &co.Oid); err != nil {
+			return nil, err
+		}
+		commonOrders = append(commonOrders, co)
+	}
+	return commonOrders, rows.Err()
+}
+
+func (s *CitusStore) GetDeliveryCursor(ctx context.Context, wid, did int64) (int64, error) {
+	var oid int64
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT next_delivery_o_id
+		FROM delivery_cursor
+		WHERE w_id = ? AND d_id = ?
+		LIMIT 1
+	`, wid, did).Row().Scan(&oid)
+	return oid, err
+}
+
+func (s *CitusStore) DeliverOrder(ctx context.Context, wid, did, oid, cid, carrierId int64) (bool, error) {
+	updated := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var isCarrierIdNull int64
+		if err := tx.Raw(`
+			SELECT COALESCE(o_carrier_id, -1)
+			FROM orders
+			WHERE o_w_id = ? AND o_d_id = ? AND o_id = ?
+			LIMIT 1
+			FOR UPDATE
+		`, wid, did, oid).Row().Scan(&isCarrierIdNull); err != nil {
+			return err
+		}
+		if isCarrierIdNull != -1 {
+			return nil
+		}
+
+		tx = tx.Exec(`
+			UPDATE orders
+			SET o_carrier_id = ?
+			WHERE o_w_id = ? AND o_d_id = ? AND o_id = ?
+		`, carrierId, wid, did, oid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		tx = tx.Exec(`
+			UPDATE delivery_cursor
+			SET next_delivery_o_id = ?
+			WHERE w_id = ? AND d_id = ? AND next_delivery_o_id < ?
+		`, oid+1, wid, did, oid+1)
+		if tx.Error != nil {
+			return tx.Error
+		}
+
+		now := time.Now().UTC()
+		tx = tx.Exec(`
+			UPDATE order_lines
+			SET ol_delivery_d = ?
+			WHERE ol_w_id = ? AND ol_d_id = ? AND ol_o_id = ?
+		`, now, wid, did, oid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		var sum float64
+		if err := tx.Raw(`
+			SELECT COALESCE(SUM(ol_amount), 0)
+			FROM order_lines
+			WHERE ol_w_id = ? AND ol_d_id = ? AND ol_o_id = ?
+		`, wid, did, oid).Row().Scan(&sum); err != nil {
+			return err
+		}
+
+		tx = tx.Exec(`
+			UPDATE customer_param
+			SET c_balance = c_balance + ?, c_delivery_cnt = c_delivery_cnt + 1
+			WHERE c_w_id = ? AND c_d_id = ? AND c_id = ?
+		`, sum, wid, did, cid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+		updated = true
+		return nil
+	})
+	return updated, err
+}
+
+func (s *CitusStore) ApplyCustomerPayment(ctx context.Context, wid, did, cid int64, amount float64) (string, float64, error) {
+	var balance float64
+	var paymentId string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Exec(`
+			UPDATE customer_param
+			SET c_balance = c_balance - ?,
+				c_ytd_payment = c_ytd_payment + ?,
+				c_payment_cnt = c_payment_cnt + 1
+			WHERE c_w_id = ? AND c_d_id = ? AND c_id = ?`,
+			amount, amount, wid, did, cid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		if err := tx.Raw(`
+			SELECT c_balance
+			FROM customer_param
+			WHERE c_w_id = ? AND c_d_id = ? AND c_id = ?`,
+			wid, did, cid).Row().Scan(&balance); err != nil {
+			return err
+		}
+
+		paymentId = uuid.New().String()
+		tx = tx.Exec(`
+			INSERT INTO payment_history(id, w_id, d_id, c_id, amount) VALUES
+			(?, ?, ?, ?, ?)
+		`, paymentId, wid, did, cid, amount)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		return nil
+	})
+	return paymentId, balance, err
+}
+
+func (s *CitusStore) ApplyWarehousePayment(ctx context.Context, paymentId string, wid, did, cid int64, amount float64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Exec(`
+			UPDATE warehouse_param
+			SET w_ytd = w_ytd + ?
+			WHERE w_id = ?
+		`, amount, wid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		tx = tx.Exec(`
+			UPDATE payment_history
+			SET is_w_ytd_updated = 1
+			WHERE id = ? AND w_id = ? AND d_id = ? AND c_id = ?
+		`, paymentId, wid, did, cid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		return nil
+	})
+}
+
+func (s *CitusStore) ApplyDistrictPayment(ctx context.Context, paymentId string, wid, did, cid int64, amount float64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Exec(`
+			UPDATE district_param
+			SET d_ytd = d_ytd + ?
+			WHERE d_w_id = ? AND d_id = ?
+		`, amount, wid, did)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		tx = tx.Exec(`
+			UPDATE payment_history
+			SET is_d_ytd_updated = 1
+			WHERE id = ? AND w_id = ? AND d_id = ? AND c_id = ?
+		`, paymentId, wid, did, cid)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		return nil
+	})
+}
+
+func (s *CitusStore) GetPaymentPointers(ctx context.Context) ([]*PaymentPointer, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		SELECT w_id, d_id, pointer
+		FROM payment_pointer
+		LIMIT 10000
+	`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paymentPointers := make([]*PaymentPointer, 0)
+	for rows.Next() {
+		ptr := &PaymentPointer{}
+		if err := rows.Scan(&ptr.Wid, &ptr.Did, &ptr.Pointer); err != nil {
+			return nil, err
+		}
+		paymentPointers = append(paymentPointers, ptr)
+	}
+	return paymentPointers, rows.Err()
+}
+
+func (s *CitusStore) CompensatePayments(ctx context.Context, ptr *PaymentPointer, limit int) (bool, error) {
+	hasUpdate := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows, err := tx.Raw(`
+			SELECT id, w_id, d_id, c_id, amount, is_w_ytd_updated, is_d_ytd_updated, created_at
+			FROM payment_history
+			WHERE w_id = ? AND d_id = ? AND created_at > ?
+			ORDER BY created_at
+			LIMIT ?
+		`, ptr.Wid, ptr.Did, ptr.Pointer, limit).Rows()
+		if err != nil {
+			return err
+		}
+		hists := make([]*PaymentHistory, 0)
+		for rows.Next() {
+			h := &PaymentHistory{}
+			if err := rows.Scan(&h.PaymentId, &h.Wid, &h.Did, &h.Cid, &h.Amount, &h.IsWYtdUpdated, &h.IsDYtdUpdated, &h.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			hists = append(hists, h)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(hists) == 0 {
+			return nil
+		}
+
+		deltaWYtd := 0.0
+		deltaDYtd := 0.0
+		for _, h := range hists {
+			if h.IsWYtdUpdated == 0 {
+				deltaWYtd += h.Amount
+			}
+			if h.IsDYtdUpdated == 0 {
+				deltaDYtd += h.Amount
+			}
+		}
+
+		if deltaWYtd > 0 {
+			tx = tx.Exec(`
+				UPDATE warehouse_param
+				SET w_ytd = w_ytd + ?
+				WHERE w_id = ?
+			`, deltaWYtd, ptr.Wid)
+			if tx.Error != nil {
+				return tx.Error
+			} else if tx.RowsAffected == 0 {
+				return ErrNoRowsAffected
+			}
+		}
+
+		if deltaDYtd > 0 {
+			tx = tx.Exec(`
+				UPDATE district_param
+				SET d_ytd = d_ytd + ?
+				WHERE d_w_id = ? AND d_id = ?
+			`, deltaDYtd, ptr.Wid, ptr.Did)
+			if tx.Error != nil {
+				return tx.Error
+			} else if tx.RowsAffected == 0 {
+				return ErrNoRowsAffected
+			}
+		}
+
+		maxCreatedAt := hists[0].CreatedAt
+		for _, h := range hists {
+			if h.IsDYtdUpdated == 0 || h.IsWYtdUpdated == 0 {
+				tx = tx.Exec(`
+					UPDATE payment_history
+					SET is_w_ytd_updated = 1, is_d_ytd_updated = 1
+					WHERE w_id = ? AND d_id = ? AND id = ?
+				`, h.Wid, h.Did, h.PaymentId)
+				if tx.Error != nil {
+					return tx.Error
+				} else if tx.RowsAffected == 0 {
+					return ErrNoRowsAffected
+				}
+			}
+			if h.CreatedAt.After(maxCreatedAt) {
+				maxCreatedAt = h.CreatedAt
+			}
+		}
+
+		tx = tx.Exec(`
+			UPDATE payment_pointer
+			SET pointer = ?
+			WHERE w_id = ? AND d_id = ?
+		`, maxCreatedAt, ptr.Wid, ptr.Did)
+		if tx.Error != nil {
+			return tx.Error
+		} else if tx.RowsAffected == 0 {
+			return ErrNoRowsAffected
+		}
+
+		hasUpdate = deltaDYtd > 0 || deltaWYtd > 0
+		return nil
+	})
+	return hasUpdate, err
+}
+
+func (s *CitusStore) GetDBState(ctx context.Context) (*DBState, error) {
+	st := &DBState{}
+	queries := []struct {
+		sql  string
+		dest []interface{}
+	}{
+		{`SELECT COALESCE(SUM(w_ytd), 0) FROM warehouse_param`, []interface{}{&st.WYtd}},
+		{`SELECT COALESCE(SUM(d_ytd), 0) FROM district_param`, []interface{}{&st.DYtd}},
+		{`SELECT COALESCE(SUM(d_next_o_id), 0) FROM district_order_id`, []interface{}{&st.DNextOId}},
+		{`
+			SELECT COALESCE(SUM(c_balance), 0), COALESCE(SUM(c_ytd_payment), 0), COALESCE(SUM(c_payment_cnt), 0), COALESCE(SUM(c_delivery_cnt), 0)
+			FROM customer_param
+		`, []interface{}{&st.CBalance, &st.CYtdPayment, &st.CPaymentCnt, &st.CDeliveryCnt}},
+		{`SELECT COALESCE(MAX(o_id), 0), COALESCE(SUM(o_ol_cnt), 0) FROM orders`, []interface{}{&st.OIdMax, &st.OOlCnt}},
+		{`SELECT COALESCE(SUM(ol_amount), 0), COALESCE(SUM(ol_quantity), 0) FROM order_lines`, []interface{}{&st.OlAmount, &st.OlQuantity}},
+		{`
+			SELECT COALESCE(SUM(s_qty), 0), COALESCE(SUM(s_ytd), 0), COALESCE(SUM(s_order_cnt), 0), COALESCE(SUM(s_remote_cnt), 0)
+			FROM stocks
+		`, []interface{}{&st.SQuantity, &st.SYtd, &st.SOrderCnt, &st.SRemoteCnt}},
+	}
+	for _, q := range queries {
+		if err := s.db.WithContext(ctx).Raw(q.sql).Row().Scan(q.dest...); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+func (s *CitusStore) GetWarehouseYtds(ctx context.Context) (map[int64]float64, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		SELECT w_id, w_ytd
+		FROM warehouse_param
+	`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ytds := make(map[int64]float64, 0)
+	for rows.Next() {
+		var wid int64
+		var ytd float64
+		if err := rows.Scan(&wid, &ytd); err != nil {
+			return nil, err
+		}
+		ytds[wid] = ytd
+	}
+	return ytds, rows.Err()
+}
+
+// GetDistrictStates runs one query per condition. Every join is on the
+// warehouse id, so Citus pushes them down to the shards.
+func (s *CitusStore) GetDistrictStates(ctx context.Context) ([]*DistrictState, error) {
+	rows, err := s.db.WithContext(ctx).Raw(`
+		SELECT p.d_w_id, p.d_id, p.d_ytd, n.d_next_o_id
+		FROM district_param p
+		JOIN district_order_id n ON n.d_w_id = p.d_w_id AND n.d_id = p.d_id
+	`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make([]*DistrictState, 0)
+	byKey := make(map[districtKey]*DistrictState, 0)
+	for rows.Next() {
+		ds := &DistrictState{}
+		if err := rows.Scan(&ds.Wid, &ds.Did, &ds.DYtd, &ds.NextOId); err != nil {
+			return nil, err
+		}
+		states = append(states, ds)
+		byKey[districtKey{Wid: ds.Wid, Did: ds.Did}] = ds
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Each query returns w_id, d_id and two numbers, written by set.
+	queries := []struct {
+		sql string
+		set func(ds *DistrictState, a, b int64)
+	}{
+		{`
+			SELECT o_w_id, o_d_id, MAX(o_id), 0
+			FROM orders
+			GROUP BY o_w_id, o_d_id
+		`, func(ds *DistrictState, a, b int64) { ds.MaxOId = a }},
+		{`
+			SELECT o.o_w_id, o.o_d_id, COUNT(*), MIN(o.o_id)
+			FROM orders o
+			LEFT JOIN (
+				SELECT ol_w_id, ol_d_id, ol_o_id, COUNT(*) AS n
+				FROM order_lines
+				GROUP BY ol_w_id, ol_d_id, ol_o_id
+			) l ON l.ol_w_id = o.o_w_id AND l.ol_d_id = o.o_d_id AND l.ol_o_id = o.o_id
+			WHERE o.o_ol_cnt <> COALESCE(l.n, 0)
+			GROUP BY o.o_w_id, o.o_d_id
+		`, func(ds *DistrictState, a, b int64) { ds.OlCnt = Violations{Count: a, ExampleId: b} }},
+		{`
+			SELECT o.o_w_id, o.o_d_id, COUNT(*), MIN(o.o_id)
+			FROM orders o
+			JOIN (
+				SELECT ol_w_id, ol_d_id, ol_o_id, COUNT(ol_delivery_d) AS delivered, COUNT(*) AS n
+				FROM order_lines
+				GROUP BY ol_w_id, ol_d_id, ol_o_id
+			) l ON l.ol_w_id = o.o_w_id AND l.ol_d_id = o.o_d_id AND l.ol_o_id = o.o_id
+			WHERE (o.o_carrier_id IS NULL AND l.delivered > 0) OR (o.o_carrier_id IS NOT NULL AND l.delivered < l.n)
+			GROUP BY o.o_w_id, o.o_d_id
+		`, func(ds *DistrictState, a, b int64) { ds.Delivery = Violations{Count: a, ExampleId: b} }},
+		{`
+			SELECT c.c_w_id, c.c_d_id, COUNT(*), MIN(c.c_id)
+			FROM customer_param c
+			LEFT JOIN (
+				SELECT o.o_w_id, o.o_d_id, o.o_c_id, SUM(ol.ol_amount) AS amount
+				FROM orders o
+				JOIN order_lines ol ON ol.ol_w_id = o.o_w_id AND ol.ol_d_id = o.o_d_id AND ol.ol_o_id = o.o_id
+				WHERE o.o_carrier_id IS NOT NULL
+				GROUP BY o.o_w_id, o.o_d_id, o.o_c_id
+			) d ON d.o_w_id = c.c_w_id AND d.o_d_id = c.c_d_id AND d.o_c_id = c.c_id
+			WHERE ABS(c.c_balance + c.c_ytd_payment - COALESCE(d.amount, 0)) >= 0.01
+			GROUP BY c.c_w_id, c.c_d_id
+		`, func(ds *DistrictState, a, b int64) { ds.Balance = Violations{Count: a, ExampleId: b} }},
+	}
+	for _, q := range queries {
+		if err := s.scanDistrictRows(ctx, q.sql, byKey, q.set); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+func (s *CitusStore) scanDistrictRows(ctx context.Context, query string, byKey map[districtKey]*DistrictState, set func(ds *DistrictState, a, b int64)) error {
+	rows, err := s.db.WithContext(ctx).Raw(query).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wid, did, a, b int64
+		if err := rows.Scan(&wid, &did, &a, &b); err != nil {
+			return err
+		}
+		if ds, ok := byKey[districtKey{Wid: wid, Did: did}]; ok {
+			set(ds, a, b)
+		}
+	}
+	return rows.Err()
+}
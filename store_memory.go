@@ -0,0 +1,1108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type orderKey struct {
+	Wid int64
+	Did int64
+	Oid int64
+}
+
+type stockKey struct {
+	Wid int64
+	Iid int64
+}
+
+type memoryDistrict struct {
+	info           DistrictInfo
+	nextOrderId    int64
+	ytd            float64
+	deliveryCursor int64
+	paymentPointer time.Time
+	// maxOrderId bounds the order id scans of the district.
+	maxOrderId int64
+	// payments are kept in insertion order, which is created_at order.
+	payments []*PaymentHistory
+}
+
+type memoryCustomer struct {
+	info  CustomerInfo
+	param CustomerParam
+	// orderIds are the ids of the customer's orders in insertion order.
+	orderIds []int64
+}
+
+type memoryStock struct {
+	stock    Stock
+	distInfo [DistrictsPerWarehouse]string
+}
+
+type memoryOrder struct {
+	order Order
+	lines []*Orderline
+}
+
+// MemoryStore keeps the whole data set in process. It implements Store for
+// running transaction files without a database and TableSink so that the
+// Loader can populate it from the CSV files or the data generator.
+//
+// Every method holds the store lock for its whole duration, which makes each
+// of them atomic the way the CitusStore transactions are.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	items        map[int64]*Item
+	warehouseYtd map[int64]float64
+	districts    map[districtKey]*memoryDistrict
+	customers    map[customerKey]*memoryCustomer
+	stocks       map[stockKey]*memoryStock
+	orders       map[orderKey]*memoryOrder
+	// itemOrders indexes the order lines by item for GetOrdersSharingItems.
+	// An order appears once per line of the item.
+	itemOrders map[int64][]orderKey
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items:        make(map[int64]*Item, 0),
+		warehouseYtd: make(map[int64]float64, 0),
+		districts:    make(map[districtKey]*memoryDistrict, 0),
+		customers:    make(map[customerKey]*memoryCustomer, 0),
+		stocks:       make(map[stockKey]*memoryStock, 0),
+		orders:       make(map[orderKey]*memoryOrder, 0),
+		itemOrders:   make(map[int64][]orderKey, 0),
+	}
+}
+
+func (s *MemoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	return nil
+}
+
+func (s *MemoryStore) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	return nil
+}
+
+// district returns the district, creating it when create is set.
+func (s *MemoryStore) district(wid, did int64, create bool) *memoryDistrict {
+	k := districtKey{Wid: wid, Did: did}
+	d, ok := s.districts[k]
+	if !ok && create {
+		d = &memoryDistrict{info: DistrictInfo{DWId: wid, DId: did}}
+		s.districts[k] = d
+	}
+	return d
+}
+
+func (s *MemoryStore) customer(wid, did, cid int64, create bool) *memoryCustomer {
+	k := customerKey{Wid: wid, Did: did, Cid: cid}
+	c, ok := s.customers[k]
+	if !ok && create {
+		c = &memoryCustomer{
+			info:  CustomerInfo{CWId: wid, CDId: did, CId: cid},
+			param: CustomerParam{CWId: wid, CDId: did, CId: cid},
+		}
+		s.customers[k] = c
+	}
+	return c
+}
+
+func (s *MemoryStore) stock(wid, iid int64, create bool) *memoryStock {
+	k := stockKey{Wid: wid, Iid: iid}
+	st, ok := s.stocks[k]
+	if !ok && create {
+		st = &memoryStock{stock: Stock{SWId: wid, SIId: iid}}
+		s.stocks[k] = st
+	}
+	return st
+}
+
+// addOrder registers o and its lines in the district and customer indexes.
+func (s *MemoryStore) addOrder(o *memoryOrder) error {
+	k := orderKey{Wid: o.order.OWId, Did: o.order.ODId, Oid: o.order.OId}
+	if _, ok := s.orders[k]; ok {
+		return fmt.Errorf("duplicate order %v", k)
+	}
+	s.orders[k] = o
+
+	d := s.district(k.Wid, k.Did, true)
+	if k.Oid > d.maxOrderId {
+		d.maxOrderId = k.Oid
+	}
+	c := s.customer(k.Wid, k.Did, o.order.OCId, true)
+	c.orderIds = append(c.orderIds, k.Oid)
+	for _, ol := range o.lines {
+		s.itemOrders[ol.OlIId] = append(s.itemOrders[ol.OlIId], k)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDistrictIds(ctx context.Context, wid int64) ([]int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	dids := make([]int64, 0)
+	for k := range s.districts {
+		if k.Wid == wid {
+			dids = append(dids, k.Did)
+		}
+	}
+	sort.Slice(dids, func(i, j int) bool { return dids[i] < dids[j] })
+	return dids, nil
+}
+
+func (s *MemoryStore) GetDistricts(ctx context.Context) ([]*DistrictInfo, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	districts := make([]*DistrictInfo, 0, len(s.districts))
+	for _, d := range s.districts {
+		di := d.info
+		districts = append(districts, &di)
+	}
+	sort.Slice(districts, func(i, j int) bool {
+		if districts[i].DWId != districts[j].DWId {
+			return districts[i].DWId < districts[j].DWId
+		}
+		return districts[i].DId < districts[j].DId
+	})
+	return districts, nil
+}
+
+func (s *MemoryStore) GetDistrictInfo(ctx context.Context, wid, did int64) (*DistrictInfo, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	d := s.district(wid, did, false)
+	if d == nil {
+		return nil, sql.ErrNoRows
+	}
+	di := d.info
+	return &di, nil
+}
+
+func (s *MemoryStore) GetNextOrderId(ctx context.Context, wid, did int64) (int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.RUnlock()
+
+	d := s.district(wid, did, false)
+	if d == nil {
+		return 0, sql.ErrNoRows
+	}
+	return d.nextOrderId, nil
+}
+
+func (s *MemoryStore) AllocateOrderId(ctx context.Context, wid, did int64) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	d := s.district(wid, did, false)
+	if d == nil {
+		return 0, sql.ErrNoRows
+	}
+	oid := d.nextOrderId
+	d.nextOrderId++
+	return oid, nil
+}
+
+func (s *MemoryStore) GetCustomerInfo(ctx context.Context, wid, did, cid int64) (*CustomerInfo, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	c := s.customer(wid, did, cid, false)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+	ci := c.info
+	return &ci, nil
+}
+
+func (s *MemoryStore) GetCustomerParam(ctx context.Context, wid, did, cid int64) (*CustomerParam, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	c := s.customer(wid, did, cid, false)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+	cp := c.param
+	return &cp, nil
+}
+
+func (s *MemoryStore) GetTopBalanceCustomers(ctx context.Context, wids []int64, limit int) ([]*CustomerParam, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	byWarehouse := make(map[int64][]*CustomerParam, len(wids))
+	for _, wid := range wids {
+		byWarehouse[wid] = nil
+	}
+	for k, c := range s.customers {
+		if _, ok := byWarehouse[k.Wid]; ok {
+			cp := c.param
+			byWarehouse[k.Wid] = append(byWarehouse[k.Wid], &cp)
+		}
+	}
+	customers := make([]*CustomerParam, 0)
+	for _, wid := range wids {
+		customers = append(customers, topBalanceCustomers(byWarehouse[wid], limit)...)
+	}
+	return customers, nil
+}
+
+// topBalanceCustomers returns the limit customers of one warehouse with the
+// highest balance.
+func topBalanceCustomers(customers []*CustomerParam, limit int) []*CustomerParam {
+	sort.Slice(customers, func(i, j int) bool {
+		a, b := customers[i], customers[j]
+		if a.CBalance != b.CBalance {
+			return a.CBalance > b.CBalance
+		}
+		if a.CDId != b.CDId {
+			return a.CDId < b.CDId
+		}
+		return a.CId < b.CId
+	})
+	if len(customers) > limit {
+		customers = customers[:limit]
+	}
+	return customers
+}
+
+func (s *MemoryStore) GetItem(ctx context.Context, iid int64) (*Item, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[iid]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	i := *item
+	return &i, nil
+}
+
+func (s *MemoryStore) GetItemNames(ctx context.Context, iids []int64) (map[int64]string, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	names := make(map[int64]string, len(iids))
+	for _, iid := range iids {
+		if item, ok := s.items[iid]; ok {
+			names[iid] = item.IName
+		}
+	}
+	return names, nil
+}
+
+func (s *MemoryStore) GetStock(ctx context.Context, wid, iid int64) (*Stock, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	st := s.stock(wid, iid, false)
+	if st == nil {
+		return nil, sql.ErrNoRows
+	}
+	stock := st.stock
+	return &stock, nil
+}
+
+func (s *MemoryStore) GetStockDistInfo(ctx context.Context, wid, iid, did int64) (string, error) {
+	if err := s.rlock(ctx); err != nil {
+		return "", err
+	}
+	defer s.mu.RUnlock()
+
+	st := s.stock(wid, iid, false)
+	if st == nil {
+		return "", sql.ErrNoRows
+	}
+	if did < 1 || did > DistrictsPerWarehouse {
+		return "", fmt.Errorf("invalid district id %v", did)
+	}
+	return st.distInfo[did-1], nil
+}
+
+func (s *MemoryStore) CountStocksBelow(ctx context.Context, wid int64, iids []int64, threshold int64) (int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.RUnlock()
+
+	// Like "s_i_id in (...)", an item listed twice is counted once.
+	seen := make(map[int64]bool, len(iids))
+	var count int64
+	for _, iid := range iids {
+		if seen[iid] {
+			continue
+		}
+		seen[iid] = true
+		if st := s.stock(wid, iid, false); st != nil && st.stock.SQty < threshold {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) ApplyStockDeltas(ctx context.Context, deltas []*StockDelta) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, d := range deltas {
+		if s.stock(d.SupplyWid, d.ItemId, false) == nil {
+			return ErrNoRowsAffected
+		}
+	}
+	for _, d := range deltas {
+		st := &s.stock(d.SupplyWid, d.ItemId, false).stock
+		st.SQty += d.Quantity
+		st.SYtd += d.Ytd
+		st.SOrderCnt += d.OrderCount
+		st.SRemoteCnt += d.RemoteCount
+	}
+	return nil
+}
+
+func (s *MemoryStore) UpdateStocks(ctx context.Context, keys []*StockKey, update func(stock *Stock) *StockDelta) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, k := range keys {
+		if s.stock(k.Wid, k.Iid, false) == nil {
+			return sql.ErrNoRows
+		}
+	}
+	// A key listed twice sees the update of the first.
+	for _, k := range keys {
+		st := &s.stock(k.Wid, k.Iid, false).stock
+		stock := *st
+		d := update(&stock)
+		st.SQty += d.Quantity
+		st.SYtd += d.Ytd
+		st.SOrderCnt += d.OrderCount
+		st.SRemoteCnt += d.RemoteCount
+	}
+	return nil
+}
+
+func (s *MemoryStore) CountLowStocks(ctx context.Context, wid, did, l, threshold int64) (int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.RUnlock()
+
+	d := s.district(wid, did, false)
+	if d == nil {
+		return 0, sql.ErrNoRows
+	}
+	seen := make(map[int64]bool, 0)
+	var count int64
+	s.orderRange(wid, did, d.nextOrderId-l, d.nextOrderId-1, func(o *memoryOrder) {
+		for _, ol := range o.lines {
+			if seen[ol.OlIId] {
+				continue
+			}
+			seen[ol.OlIId] = true
+			if st := s.stock(wid, ol.OlIId, false); st != nil && st.stock.SQty < threshold {
+				count++
+			}
+		}
+	})
+	return count, nil
+}
+
+func (s *MemoryStore) InsertOrder(ctx context.Context, order *Order, lines []*Orderline) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	o := &memoryOrder{order: *order, lines: make([]*Orderline, 0, len(lines))}
+	o.order.OCarrierId = -1
+	for _, ol := range lines {
+		line := *ol
+		line.OlDeliveryD = time.Time{}
+		o.lines = append(o.lines, &line)
+	}
+	if err := s.addOrder(o); err != nil {
+		return err
+	}
+
+	c := s.customer(order.OWId, order.ODId, order.OCId, true)
+	if c.param.CLastOId < order.OId {
+		c.param.CLastOId = order.OId
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetOrder(ctx context.Context, wid, did, oid int64) (*Order, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderKey{Wid: wid, Did: did, Oid: oid}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	order := o.order
+	return &order, nil
+}
+
+func (s *MemoryStore) GetOrderCustomerId(ctx context.Context, wid, did, oid int64) (int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderKey{Wid: wid, Did: did, Oid: oid}]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return o.order.OCId, nil
+}
+
+func (s *MemoryStore) GetCustomerOrderIds(ctx context.Context, wid, did, cid int64) ([]int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	oids := make([]int64, 0)
+	if c := s.customer(wid, did, cid, false); c != nil {
+		oids = append(oids, c.orderIds...)
+	}
+	return oids, nil
+}
+
+// orderRange calls fn for the existing orders of the district with ids in
+// [fromOid, toOid], in id order.
+func (s *MemoryStore) orderRange(wid, did, fromOid, toOid int64, fn func(o *memoryOrder)) {
+	d := s.district(wid, did, false)
+	if d == nil {
+		return
+	}
+	if fromOid < 1 {
+		fromOid = 1
+	}
+	if toOid > d.maxOrderId {
+		toOid = d.maxOrderId
+	}
+	for oid := fromOid; oid <= toOid; oid++ {
+		if o, ok := s.orders[orderKey{Wid: wid, Did: did, Oid: oid}]; ok {
+			fn(o)
+		}
+	}
+}
+
+func (s *MemoryStore) GetOrdersFrom(ctx context.Context, wid, did, fromOid int64) ([]*Order, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	orders := make([]*Order, 0)
+	s.orderRange(wid, did, fromOid, math.MaxInt64, func(o *memoryOrder) {
+		order := o.order
+		orders = append(orders, &order)
+	})
+	return orders, nil
+}
+
+func copyOrderlines(lines []*Orderline) []*Orderline {
+	copied := make([]*Orderline, 0, len(lines))
+	for _, ol := range lines {
+		line := *ol
+		copied = append(copied, &line)
+	}
+	return copied
+}
+
+func (s *MemoryStore) GetOrderlines(ctx context.Context, wid, did, oid int64) ([]*Orderline, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderKey{Wid: wid, Did: did, Oid: oid}]
+	if !ok {
+		return make([]*Orderline, 0), nil
+	}
+	return copyOrderlines(o.lines), nil
+}
+
+func (s *MemoryStore) GetLastOrder(ctx context.Context, wid, did, cid int64) (*CustomerParam, *Order, []*Orderline, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+	defer s.mu.RUnlock()
+
+	c := s.customer(wid, did, cid, false)
+	if c == nil {
+		return nil, nil, nil, sql.ErrNoRows
+	}
+	cp := c.param
+	o, ok := s.orders[orderKey{Wid: wid, Did: did, Oid: cp.CLastOId}]
+	if !ok {
+		return nil, nil, nil, sql.ErrNoRows
+	}
+	order := o.order
+	return &cp, &order, copyOrderlines(o.lines), nil
+}
+
+func (s *MemoryStore) GetOrderlinesFrom(ctx context.Context, wid, did, fromOid int64) ([]*Orderline, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	lines := make([]*Orderline, 0)
+	s.orderRange(wid, did, fromOid, math.MaxInt64, func(o *memoryOrder) {
+		lines = append(lines, copyOrderlines(o.lines)...)
+	})
+	return lines, nil
+}
+
+func (s *MemoryStore) GetOrdersWithLinesFrom(ctx context.Context, wid, did, fromOid int64) ([]*Order, []*Orderline, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer s.mu.RUnlock()
+
+	orders := make([]*Order, 0)
+	lines := make([]*Orderline, 0)
+	s.orderRange(wid, did, fromOid, math.MaxInt64, func(o *memoryOrder) {
+		order := o.order
+		orders = append(orders, &order)
+		lines = append(lines, copyOrderlines(o.lines)...)
+	})
+	return orders, lines, nil
+}
+
+func (s *MemoryStore) GetOrderlineItemIds(ctx context.Context, wid, did, fromOid, toOid int64) ([]int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	itemIds := make([]int64, 0)
+	s.orderRange(wid, did, fromOid, toOid, func(o *memoryOrder) {
+		for _, ol := range o.lines {
+			itemIds = append(itemIds, ol.OlIId)
+		}
+	})
+	return itemIds, nil
+}
+
+func (s *MemoryStore) GetOrdersSharingItems(ctx context.Context, excludeWid int64, iids []int64, minShared int) ([]*CommonOrder, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	// Like "ol_i_id in (...)", an item listed twice only matches its lines once.
+	seen := make(map[int64]bool, len(iids))
+	shared := make(map[orderKey]int, 0)
+	for _, iid := range iids {
+		if seen[iid] {
+			continue
+		}
+		seen[iid] = true
+		for _, k := range s.itemOrders[iid] {
+			if k.Wid != excludeWid {
+				shared[k]++
+			}
+		}
+	}
+
+	commonOrders := make([]*CommonOrder, 0)
+	for k, n := range shared {
+		if n >= minShared {
+			commonOrders = append(commonOrders, &CommonOrder{Wid: k.Wid, Did: k.Did, Oid: k.Oid})
+		}
+	}
+	sort.Slice(commonOrders, func(i, j int) bool {
+		a, b := commonOrders[i], commonOrders[j]
+		if a.Wid != b.Wid {
+			return a.Wid < b.Wid
+		}
+		if a.Did != b.Did {
+			return a.Did < b.Did
+		}
+		return a.Oid < b.Oid
+	})
+	return commonOrders, nil
+}
+
+func (s *MemoryStore) GetDeliveryCursor(ctx context.Context, wid, did int64) (int64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.RUnlock()
+
+	d := s.district(wid, did, false)
+	if d == nil {
+		return 0, sql.ErrNoRows
+	}
+	return d.deliveryCursor, nil
+}
+
+func (s *MemoryStore) DeliverOrder(ctx context.Context, wid, did, oid, cid, carrierId int64) (bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderKey{Wid: wid, Did: did, Oid: oid}]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	if o.order.OCarrierId != -1 {
+		return false, nil
+	}
+	c := s.customer(wid, did, cid, false)
+	if c == nil || len(o.lines) == 0 {
+		return false, ErrNoRowsAffected
+	}
+
+	o.order.OCarrierId = carrierId
+	if d := s.district(wid, did, false); d != nil && d.deliveryCursor < oid+1 {
+		d.deliveryCursor = oid + 1
+	}
+	now := time.Now().UTC()
+	var sum float64
+	for _, ol := range o.lines {
+		ol.OlDeliveryD = now
+		sum += ol.OlAmount
+	}
+	c.param.CBalance += sum
+	c.param.CDeliveryCnt++
+	return true, nil
+}
+
+func (s *MemoryStore) ApplyCustomerPayment(ctx context.Context, wid, did, cid int64, amount float64) (string, float64, error) {
+	if err := s.lock(ctx); err != nil {
+		return "", 0, err
+	}
+	defer s.mu.Unlock()
+
+	c := s.customer(wid, did, cid, false)
+	d := s.district(wid, did, false)
+	if c == nil || d == nil {
+		return "", 0, ErrNoRowsAffected
+	}
+	c.param.CBalance -= amount
+	c.param.CYtdPayment += amount
+	c.param.CPaymentCnt++
+
+	paymentId := uuid.New().String()
+	d.payments = append(d.payments, &PaymentHistory{
+		PaymentId: paymentId,
+		Wid:       wid,
+		Did:       did,
+		Cid:       cid,
+		Amount:    amount,
+		CreatedAt: time.Now().UTC(),
+	})
+	return paymentId, c.param.CBalance, nil
+}
+
+// payment finds the payment_history row of paymentId.
+func (s *MemoryStore) payment(paymentId string, wid, did, cid int64) *PaymentHistory {
+	d := s.district(wid, did, false)
+	if d == nil {
+		return nil
+	}
+	for i := len(d.payments) - 1; i >= 0; i-- {
+		if h := d.payments[i]; h.PaymentId == paymentId && h.Cid == cid {
+			return h
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ApplyWarehousePayment(ctx context.Context, paymentId string, wid, did, cid int64, amount float64) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	h := s.payment(paymentId, wid, did, cid)
+	if _, ok := s.warehouseYtd[wid]; !ok || h == nil {
+		return ErrNoRowsAffected
+	}
+	s.warehouseYtd[wid] += amount
+	h.IsWYtdUpdated = 1
+	return nil
+}
+
+func (s *MemoryStore) ApplyDistrictPayment(ctx context.Context, paymentId string, wid, did, cid int64, amount float64) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	h := s.payment(paymentId, wid, did, cid)
+	if h == nil {
+		return ErrNoRowsAffected
+	}
+	s.district(wid, did, false).ytd += amount
+	h.IsDYtdUpdated = 1
+	return nil
+}
+
+func (s *MemoryStore) GetPaymentPointers(ctx context.Context) ([]*PaymentPointer, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	paymentPointers := make([]*PaymentPointer, 0, len(s.districts))
+	for k, d := range s.districts {
+		paymentPointers = append(paymentPointers, &PaymentPointer{Wid: k.Wid, Did: k.Did, Pointer: d.paymentPointer})
+	}
+	sort.Slice(paymentPointers, func(i, j int) bool {
+		if paymentPointers[i].Wid != paymentPointers[j].Wid {
+			return paymentPointers[i].Wid < paymentPointers[j].Wid
+		}
+		return paymentPointers[i].Did < paymentPointers[j].Did
+	})
+	return paymentPointers, nil
+}
+
+func (s *MemoryStore) CompensatePayments(ctx context.Context, ptr *PaymentPointer, limit int) (bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer s.mu.Unlock()
+
+	d := s.district(ptr.Wid, ptr.Did, false)
+	if d == nil {
+		return false, ErrNoRowsAffected
+	}
+	hists := make([]*PaymentHistory, 0)
+	for _, h := range d.payments {
+		if len(hists) == limit {
+			break
+		}
+		if h.CreatedAt.After(ptr.Pointer) {
+			hists = append(hists, h)
+		}
+	}
+	if len(hists) == 0 {
+		return false, nil
+	}
+
+	deltaWYtd := 0.0
+	deltaDYtd := 0.0
+	maxCreatedAt := hists[0].CreatedAt
+	for _, h := range hists {
+		if h.IsWYtdUpdated == 0 {
+			deltaWYtd += h.Amount
+		}
+		if h.IsDYtdUpdated == 0 {
+			deltaDYtd += h.Amount
+		}
+		h.IsWYtdUpdated = 1
+		h.IsDYtdUpdated = 1
+		if h.CreatedAt.After(maxCreatedAt) {
+			maxCreatedAt = h.CreatedAt
+		}
+	}
+	d.paymentPointer = maxCreatedAt
+	s.warehouseYtd[ptr.Wid] += deltaWYtd
+	d.ytd += deltaDYtd
+	return deltaWYtd > 0 || deltaDYtd > 0, nil
+}
+
+func (s *MemoryStore) GetDBState(ctx context.Context) (*DBState, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	st := &DBState{}
+	for _, ytd := range s.warehouseYtd {
+		st.WYtd += ytd
+	}
+	for _, d := range s.districts {
+		st.DYtd += d.ytd
+		st.DNextOId += d.nextOrderId
+	}
+	for _, c := range s.customers {
+		st.CBalance += c.param.CBalance
+		st.CYtdPayment += c.param.CYtdPayment
+		st.CPaymentCnt += c.param.CPaymentCnt
+		st.CDeliveryCnt += c.param.CDeliveryCnt
+	}
+	for _, o := range s.orders {
+		if o.order.OId > st.OIdMax {
+			st.OIdMax = o.order.OId
+		}
+		st.OOlCnt += o.order.OOlCnt
+		for _, ol := range o.lines {
+			st.OlAmount += ol.OlAmount
+			st.OlQuantity += ol.OlQuantity
+		}
+	}
+	for _, stock := range s.stocks {
+		st.SQuantity += stock.stock.SQty
+		st.SYtd += stock.stock.SYtd
+		st.SOrderCnt += stock.stock.SOrderCnt
+		st.SRemoteCnt += stock.stock.SRemoteCnt
+	}
+	return st, nil
+}
+
+func (s *MemoryStore) GetWarehouseYtds(ctx context.Context) (map[int64]float64, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	ytds := make(map[int64]float64, len(s.warehouseYtd))
+	for wid, ytd := range s.warehouseYtd {
+		ytds[wid] = ytd
+	}
+	return ytds, nil
+}
+
+func (s *MemoryStore) GetDistrictStates(ctx context.Context) ([]*DistrictState, error) {
+	if err := s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.RUnlock()
+
+	byKey := make(map[districtKey]*DistrictState, len(s.districts))
+	states := make([]*DistrictState, 0, len(s.districts))
+	for k, d := range s.districts {
+		ds := &DistrictState{Wid: k.Wid, Did: k.Did, DYtd: d.ytd, NextOId: d.nextOrderId}
+		byKey[k] = ds
+		states = append(states, ds)
+	}
+
+	delivered := make(map[customerKey]float64, 0)
+	for k, o := range s.orders {
+		ds, ok := byKey[districtKey{Wid: k.Wid, Did: k.Did}]
+		if !ok {
+			continue
+		}
+		if k.Oid > ds.MaxOId {
+			ds.MaxOId = k.Oid
+		}
+		if o.order.OOlCnt != int64(len(o.lines)) {
+			ds.OlCnt.add(k.Oid)
+		}
+		linesDelivered := 0
+		for _, ol := range o.lines {
+			if !ol.OlDeliveryD.IsZero() {
+				linesDelivered++
+			}
+		}
+		isDelivered := o.order.OCarrierId != -1
+		if (!isDelivered && linesDelivered > 0) || (isDelivered && linesDelivered < len(o.lines)) {
+			ds.Delivery.add(k.Oid)
+		}
+		if isDelivered {
+			ck := customerKey{Wid: k.Wid, Did: k.Did, Cid: o.order.OCId}
+			for _, ol := range o.lines {
+				delivered[ck] += ol.OlAmount
+			}
+		}
+	}
+	for k, c := range s.customers {
+		ds, ok := byKey[districtKey{Wid: k.Wid, Did: k.Did}]
+		if !ok {
+			continue
+		}
+		if math.Abs(c.param.CBalance+c.param.CYtdPayment-delivered[k]) >= 0.01 {
+			ds.Balance.add(k.Cid)
+		}
+	}
+	return states, nil
+}
+
+// memoryRow holds one copied row by column name.
+type memoryRow map[string]interface{}
+
+func (r memoryRow) Int(col string) int64 {
+	v, _ := r[col].(int64)
+	return v
+}
+
+// NullableInt returns -1 for null, the convention of Order.OCarrierId.
+func (r memoryRow) NullableInt(col string) int64 {
+	if r[col] == nil {
+		return -1
+	}
+	return r.Int(col)
+}
+
+func (r memoryRow) Float(col string) float64 {
+	v, _ := r[col].(float64)
+	return v
+}
+
+func (r memoryRow) Str(col string) string {
+	v, _ := r[col].(string)
+	return v
+}
+
+func (r memoryRow) Bool(col string) bool {
+	v, _ := r[col].(bool)
+	return v
+}
+
+// Time returns the zero time for null.
+func (r memoryRow) Time(col string) time.Time {
+	v, _ := r[col].(time.Time)
+	return v
+}
+
+// CopyRows stores the rows of one of the loaded tables. Tables that split one
+// entity, like customer_info and customer_param, may arrive in any order.
+func (s *MemoryStore) CopyRows(ctx context.Context, table string, columns []string, rows pgx.CopyFromSource) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+
+	var n int64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return n, err
+		}
+		if len(values) != len(columns) {
+			return n, fmt.Errorf("%s: expected %v values, got %v", table, len(columns), len(values))
+		}
+		r := make(memoryRow, len(columns))
+		for i, col := range columns {
+			r[col] = values[i]
+		}
+		if err := s.copyRow(table, r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+func (s *MemoryStore) copyRow(table string, r memoryRow) error {
+	switch table {
+	case "items":
+		s.items[r.Int("i_id")] = &Item{IId: r.Int("i_id"), IName: r.Str("i_name"), IPrice: r.Float("i_price")}
+	case "warehouse_param":
+		s.warehouseYtd[r.Int("w_id")] = r.Float("w_ytd")
+	case "district_info":
+		d := s.district(r.Int("d_w_id"), r.Int("d_id"), true)
+		d.info = DistrictInfo{
+			DId: r.Int("d_id"), DWId: r.Int("d_w_id"),
+			WName: r.Str("w_name"), WStreet1: r.Str("w_street_1"), WStreet2: r.Str("w_street_2"),
+			WCity: r.Str("w_city"), WState: r.Str("w_state"), WZip: r.Str("w_zip"), WTax: r.Float("w_tax"),
+			DName: r.Str("d_name"), DStreet1: r.Str("d_street_1"), DStreet2: r.Str("d_street_2"),
+			DCity: r.Str("d_city"), DState: r.Str("d_state"), DZip: r.Str("d_zip"), DTax: r.Float("d_tax"),
+		}
+	case "district_order_id":
+		s.district(r.Int("d_w_id"), r.Int("d_id"), true).nextOrderId = r.Int("d_next_o_id")
+	case "district_param":
+		s.district(r.Int("d_w_id"), r.Int("d_id"), true).ytd = r.Float("d_ytd")
+	case "delivery_cursor":
+		s.district(r.Int("w_id"), r.Int("d_id"), true).deliveryCursor = r.Int("next_delivery_o_id")
+	case "payment_pointer":
+		s.district(r.Int("w_id"), r.Int("d_id"), true).paymentPointer = r.Time("pointer")
+	case "customer_info":
+		c := s.customer(r.Int("c_w_id"), r.Int("c_d_id"), r.Int("c_id"), true)
+		c.info = CustomerInfo{
+			CWId: r.Int("c_w_id"), CDId: r.Int("c_d_id"), CId: r.Int("c_id"),
+			CFirst: r.Str("c_first"), CMiddle: r.Str("c_middle"), CLast: r.Str("c_last"),
+			CStreet1: r.Str("c_street_1"), CStreet2: r.Str("c_street_2"), CCity: r.Str("c_city"),
+			CState: r.Str("c_state"), CZip: r.Str("c_zip"), CPhone: r.Str("c_phone"), CSince: r.Time("c_since"),
+			CCredit: r.Str("c_credit"), CCreditLim: r.Float("c_credit_lim"), CDiscount: r.Float("c_discount"), CData: r.Str("c_data"),
+		}
+	case "customer_param":
+		c := s.customer(r.Int("c_w_id"), r.Int("c_d_id"), r.Int("c_id"), true)
+		c.param = CustomerParam{
+			CWId: r.Int("c_w_id"), CDId: r.Int("c_d_id"), CId: r.Int("c_id"),
+			CBalance: r.Float("c_balance"), CYtdPayment: r.Float("c_ytd_payment"),
+			CPaymentCnt: r.Int("c_payment_cnt"), CDeliveryCnt: r.Int("c_delivery_cnt"), CLastOId: r.Int("c_last_o_id"),
+		}
+	case "orders":
+		return s.addOrder(&memoryOrder{order: Order{
+			OWId: r.Int("o_w_id"), ODId: r.Int("o_d_id"), OId: r.Int("o_id"), OCId: r.Int("o_c_id"),
+			OCarrierId: r.NullableInt("o_carrier_id"), OOlCnt: r.Int("o_ol_cnt"),
+			OAllLocal: r.Bool("o_all_local"), OEntryD: r.Time("o_entry_d"),
+		}})
+	case "order_lines":
+		k := orderKey{Wid: r.Int("ol_w_id"), Did: r.Int("ol_d_id"), Oid: r.Int("ol_o_id")}
+		o, ok := s.orders[k]
+		if !ok {
+			return fmt.Errorf("order line references unknown order %v", k)
+		}
+		ol := &Orderline{
+			OlWId: k.Wid, OlDId: k.Did, OlOId: k.Oid, OlNumber: r.Int("ol_number"),
+			OlIId: r.Int("ol_i_id"), OlIName: r.Str("ol_i_name"), OlDeliveryD: r.Time("ol_delivery_d"),
+			OlAmount: r.Float("ol_amount"), OlSupplyWId: r.Int("ol_supply_w_id"), OlQuantity: r.Int("ol_quantity"),
+			OlDistInfo: r.Str("ol_dist_info"),
+		}
+		o.lines = append(o.lines, ol)
+		s.itemOrders[ol.OlIId] = append(s.itemOrders[ol.OlIId], k)
+	case "stocks":
+		st := s.stock(r.Int("s_w_id"), r.Int("s_i_id"), true)
+		st.stock = Stock{
+			SWId: r.Int("s_w_id"), SIId: r.Int("s_i_id"), SQty: r.Int("s_qty"), SYtd: r.Float("s_ytd"),
+			SOrderCnt: r.Int("s_order_cnt"), SRemoteCnt: r.Int("s_remote_cnt"),
+		}
+	case "stock_info_by_district":
+		st := s.stock(r.Int("s_w_id"), r.Int("s_i_id"), true)
+		for i := range st.distInfo {
+			st.distInfo[i] = r.Str(fmt.Sprintf("s_dist_%02d", i+1))
+		}
+	default:
+		return fmt.Errorf("memory store has no table %s", table)
+	}
+	return nil
+}
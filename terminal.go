@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Think time distributions.
+const (
+	ThinkFixed  = "fixed"
+	ThinkNegExp = "negexp"
+)
+
+// negExpCap bounds negative exponential think times at 10 times their mean,
+// as TPC-C does.
+const negExpCap = 10
+
+// TerminalTimes emulates a TPC-C terminal around one transaction type: the
+// keying time is spent before the command, the think time after it. Neither
+// counts towards latency.
+type TerminalTimes struct {
+	Keying time.Duration `yaml:"keying"`
+	// Think is the think time, or its mean when ThinkDist is negexp.
+	Think     time.Duration `yaml:"think"`
+	ThinkDist string        `yaml:"think_dist"`
+}
+
+// override returns t with the non-zero fields of o.
+func (t TerminalTimes) override(o TerminalTimes) TerminalTimes {
+	if o.Keying != 0 {
+		t.Keying = o.Keying
+	}
+	if o.Think != 0 {
+		t.Think = o.Think
+	}
+	if o.ThinkDist != "" {
+		t.ThinkDist = o.ThinkDist
+	}
+	return t
+}
+
+func (t TerminalTimes) enabled() bool {
+	return t.Keying > 0 || t.Think > 0
+}
+
+// ThinkTime draws a think time.
+func (t TerminalTimes) ThinkTime(r *rand.Rand) time.Duration {
+	if t.ThinkDist != ThinkNegExp || t.Think <= 0 {
+		return t.Think
+	}
+	d := time.Duration(r.ExpFloat64() * float64(t.Think))
+	if d > negExpCap*t.Think {
+		d = negExpCap * t.Think
+	}
+	return d
+}
+
+// sleepContext sleeps for d, returning ctx.Err() if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TimeSeries writes what one client did per fixed interval, so warm-up,
+// stalls and degradation over a long run show up. Intervals are closed when
+// the first transaction after their end is recorded; intervals without any
+// transaction are written as zero rows, so a stall is visible as a gap in
+// throughput rather than a missing row.
+type TimeSeries struct {
+	clientId int
+	interval time.Duration
+	start    time.Time
+	// from and to bound the current interval.
+	from     time.Time
+	to       time.Time
+	outcomes [len(outcomeNames)]int64
+	retries  int64
+	latency  *Histogram
+
+	file *os.File
+	out  *csv.Writer
+}
+
+var timeSeriesHeader = []string{"client_id", "from", "elapsed_s", "seconds", "committed", "aborted", "invalid", "partial", "retries", "throughput"}
+
+// NewTimeSeries starts the time series at path. A resumed client appends to
+// it, its intervals starting over at the resumption.
+func NewTimeSeries(path string, clientId int, start time.Time, interval time.Duration, resume bool) (*TimeSeries, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	ts := &TimeSeries{
+		clientId: clientId,
+		interval: interval,
+		start:    start,
+		from:     start,
+		to:       start.Add(interval),
+		latency:  NewHistogram(),
+		file:     file,
+		out:      csv.NewWriter(file),
+	}
+	if info.Size() == 0 {
+		ts.out.Write(append(timeSeriesHeader, latencySummaryHeader...))
+		ts.out.Flush()
+	}
+	return ts, ts.out.Error()
+}
+
+// Record adds a transaction that ended at end.
+func (ts *TimeSeries) Record(end time.Time, outcome Outcome, retries int, latency time.Duration) {
+	ts.advance(end)
+	ts.outcomes[outcome]++
+	ts.retries += int64(retries)
+	if outcome == OutcomeCommitted {
+		ts.latency.Record(latency)
+	}
+}
+
+// advance writes every interval that ended before now.
+func (ts *TimeSeries) advance(now time.Time) {
+	for !now.Before(ts.to) {
+		ts.flush(ts.to)
+		ts.from, ts.to = ts.to, ts.to.Add(ts.interval)
+	}
+}
+
+func (ts *TimeSeries) flush(to time.Time) {
+	seconds := to.Sub(ts.from).Seconds()
+	throughput := 0.0
+	if seconds > 0 {
+		throughput = float64(ts.outcomes[OutcomeCommitted]) / seconds
+	}
+	row := []string{fmt.Sprint(ts.clientId), ts.from.UTC().Format(time.RFC3339Nano), fmt.Sprintf("%.3f", to.Sub(ts.start).Seconds()), fmt.Sprintf("%.3f", seconds)}
+	for _, n := range ts.outcomes {
+		row = append(row, fmt.Sprint(n))
+	}
+	row = append(row, fmt.Sprint(ts.retries), fmt.Sprintf("%.2f", throughput))
+	ts.out.Write(append(row, summarize(ts.latency).record()...))
+	ts.out.Flush()
+
+	ts.outcomes = [len(outcomeNames)]int64{}
+	ts.retries = 0
+	ts.latency = NewHistogram()
+}
+
+// Close writes the intervals up to end, the last one cut short, and closes
+// the file.
+func (ts *TimeSeries) Close(end time.Time) error {
+	ts.advance(end)
+	if end.After(ts.from) {
+		ts.flush(end)
+	}
+	if err := ts.out.Error(); err != nil {
+		ts.file.Close()
+		return err
+	}
+	return ts.file.Close()
+}
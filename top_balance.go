@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"sort"
 	"strings"
-
-	"gorm.io/gorm"
 )
 
 type TopCustomerInfo struct {
@@ -20,108 +18,61 @@ type TopCustomerInfo struct {
 	CLast    string
 }
 
-type TopDistrictInfo struct {
-	Did   int64
-	Wid   int64
-	WName string
-	DName string
-}
-
-func TopBalance(logs *log.Logger, db *gorm.DB, words []string, scanner *bufio.Scanner, lineCount *int) error {
-	districts := make([]*TopDistrictInfo, 0)
-	db = db.Raw(`
-		select d_id, d_w_id, w_name, d_name 
-		from district_info 
-		LIMIT 10000
-	`)
-	rows, err := db.Rows()
+func TopBalance(ctx context.Context, logs *log.Logger, store Store, retry *Retrier, cmd *TopBalanceCmd) Outcome {
+	districts, err := store.GetDistricts(ctx)
 	if err != nil {
 		logs.Printf("top balance get district failed: %v", err)
-		return err
+		return failed(err, false)
 	}
 	widSet := make(map[int64]bool, 0)
-	for rows.Next() {
-		district := &TopDistrictInfo{}
-		if err := rows.Scan(&district.Did, &district.Wid, &district.WName, &district.DName); err != nil {
-			logs.Printf("top balance scan district failed: %v", err)
+	wids := make([]int64, 0)
+	for _, district := range districts {
+		if !widSet[district.DWId] {
+			widSet[district.DWId] = true
+			wids = append(wids, district.DWId)
 		}
-		districts = append(districts, district)
-		widSet[district.Wid] = true
 	}
 
-	customerInfos := make([]*TopCustomerInfo, 0)
+	var customerInfos []*TopCustomerInfo
 	getTopBalanceCustomerTxn := func() error {
-		return db.Transaction(func(tx *gorm.DB) error {
-			for wid := range widSet {
-				tx = tx.Raw(`
-					select c_w_id, c_d_id, c_id, c_balance 
-					from customer_param
-					where c_w_id = ? 
-					order by c_balance desc 
-					limit 10
-				`, wid)
-				rows, err := tx.Rows()
-				if err != nil {
-					return err
-				}
-				for rows.Next() {
-					c := &TopCustomerInfo{}
-					if err := rows.Scan(&c.Wid, &c.Did, &c.Cid, &c.CBalance); err != nil {
-						return err
-					}
-					customerInfos = append(customerInfos, c)
-				}
-			}
-			return nil
-		})
+		customers, err := store.GetTopBalanceCustomers(ctx, wids, 10)
+		if err != nil {
+			return err
+		}
+		customerInfos = make([]*TopCustomerInfo, 0, len(customers))
+		for _, c := range customers {
+			customerInfos = append(customerInfos, &TopCustomerInfo{Wid: c.CWId, Did: c.CDId, Cid: c.CId, CBalance: c.CBalance})
+		}
+		return nil
 	}
-	if err := Retry(getTopBalanceCustomerTxn); err != nil {
+	if err := retry.Do(ctx, getTopBalanceCustomerTxn); err != nil {
 		logs.Printf("top balance get customer failed: %v", err)
-		return nil
+		return failed(err, false)
 	}
 
 	sort.Slice(customerInfos, func(i, j int) bool {
 		return customerInfos[i].CBalance < customerInfos[j].CBalance
 	})
 
-	topTenCustomers := customerInfos[:10]
-
-	cids := make([]int64, 0)
-	for _, c := range topTenCustomers {
-		cids = append(cids, c.Cid)
+	topTenCustomers := customerInfos
+	if len(topTenCustomers) > 10 {
+		topTenCustomers = topTenCustomers[:10]
 	}
-	db = db.Raw(`
-		SELECT c_id, c_first, c_middle, c_last 
-		FROM customer_info
-		WHERE c_id IN ?
-	`, cids)
-	rows, err = db.Rows()
-	if err != nil {
-		logs.Printf("top balance get customer name failed: %v", err)
-		return nil
-	}
-	for rows.Next() {
-		var cid int64
-		var cFirst, cMiddle, cLast string
-		if err := rows.Scan(&cid, &cFirst, &cMiddle, &cLast); err != nil {
-			logs.Printf("top balance scan customer name failed: %v", err)
-			return nil
-		}
-		for _, cinfo := range topTenCustomers {
-			if cinfo.Cid == cid {
-				cinfo.CFirst = cFirst
-				cinfo.CMiddle = cMiddle
-				cinfo.CLast = cLast
-				break
-			}
+
+	for _, cinfo := range topTenCustomers {
+		ci, err := store.GetCustomerInfo(ctx, cinfo.Wid, cinfo.Did, cinfo.Cid)
+		if err != nil {
+			logs.Printf("top balance get customer name failed: %v", err)
+			return failed(err, false)
 		}
+		cinfo.CFirst, cinfo.CMiddle, cinfo.CLast = ci.CFirst, ci.CMiddle, ci.CLast
 	}
 
 	sb := strings.Builder{}
 	for _, cinfo := range topTenCustomers {
 		var dName, wName string
 		for _, d := range districts {
-			if d.Did == cinfo.Did && d.Wid == cinfo.Wid {
+			if d.DId == cinfo.Did && d.DWId == cinfo.Wid {
 				dName = d.DName
 				wName = d.WName
 				break
@@ -132,5 +83,5 @@ func TopBalance(logs *log.Logger, db *gorm.DB, words []string, scanner *bufio.Sc
 	}
 	logs.Printf(sb.String())
 
-	return nil
+	return OutcomeCommitted
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TxnTypes lists the transaction codes of the transaction files in the
+// order they are reported.
+var TxnTypes = []string{"N", "P", "D", "O", "S", "I", "T", "R"}
+
+// Distribution draws ids in [1, n].
+type Distribution func(r *rand.Rand) int64
+
+// ParseDistribution understands "uniform", "nurand[:A]" and "zipf[:S]". The
+// NURand constant A defaults to defaultA; the Zipf exponent must exceed 1.
+func ParseDistribution(spec string, n int64, defaultA int64, r *rand.Rand) (Distribution, error) {
+	name, param, hasParam := strings.Cut(spec, ":")
+	switch name {
+	case "uniform":
+		return func(r *rand.Rand) int64 {
+			return 1 + r.Int63n(n)
+		}, nil
+	case "nurand":
+		a := defaultA
+		if hasParam {
+			v, err := strconv.ParseInt(param, 10, 64)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("invalid NURand A in %q", spec)
+			}
+			a = v
+		}
+		c := r.Int63n(a + 1)
+		return func(r *rand.Rand) int64 {
+			return NURand(r, a, 1, n, c)
+		}, nil
+	case "zipf":
+		s := 1.1
+		if hasParam {
+			v, err := strconv.ParseFloat(param, 64)
+			if err != nil || v <= 1 {
+				return nil, fmt.Errorf("invalid zipf exponent in %q: must be a number above 1", spec)
+			}
+			s = v
+		}
+		if n == 1 {
+			return func(r *rand.Rand) int64 { return 1 }, nil
+		}
+		zipf := rand.NewZipf(r, s, 1, uint64(n-1))
+		return func(r *rand.Rand) int64 {
+			return 1 + int64(zipf.Uint64())
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", spec)
+	}
+}
+
+// ParseMix parses "N=45,P=43,D=4,O=4,S=4" into weights per transaction type.
+// Weights are relative and need not sum to 100.
+func ParseMix(spec string) (map[string]float64, error) {
+	mix := make(map[string]float64, 0)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, w, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mix entry %q, expected TYPE=WEIGHT", part)
+		}
+		t = strings.TrimSpace(t)
+		if !isTxnType(t) {
+			return nil, fmt.Errorf("unknown transaction type %q in mix", t)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s", w, t)
+		}
+		mix[t] = weight
+	}
+
+	var total float64
+	for _, w := range mix {
+		total += w
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("transaction mix %q has no positive weight", spec)
+	}
+	return mix, nil
+}
+
+func isTxnType(t string) bool {
+	for _, tt := range TxnTypes {
+		if tt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// TxnGenerator writes transaction files in the format consumed by run.
+type TxnGenerator struct {
+	cfg        *GenConfig
+	warehouses int64
+	rand       *rand.Rand
+
+	types      []string
+	cumWeights []float64
+
+	warehouse Distribution
+	customer  Distribution
+	item      Distribution
+}
+
+func NewTxnGenerator(cfg *GenConfig, warehouses int, seed int64) (*TxnGenerator, error) {
+	g := &TxnGenerator{
+		cfg:        cfg,
+		warehouses: int64(warehouses),
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+
+	mix, err := ParseMix(cfg.Mix)
+	if err != nil {
+		return nil, err
+	}
+	var total float64
+	for _, t := range TxnTypes {
+		if mix[t] == 0 {
+			continue
+		}
+		total += mix[t]
+		g.types = append(g.types, t)
+		g.cumWeights = append(g.cumWeights, total)
+	}
+
+	// NURand A values of TPC-C clause 2.1.6; warehouses have none, 1 keeps
+	// the distribution close to uniform for small scale factors.
+	if g.warehouse, err = ParseDistribution(cfg.WarehouseDist, g.warehouses, 1, g.rand); err != nil {
+		return nil, fmt.Errorf("warehouse distribution: %v", err)
+	}
+	if g.customer, err = ParseDistribution(cfg.CustomerDist, CustomersPerDistrict, 1023, g.rand); err != nil {
+		return nil, fmt.Errorf("customer distribution: %v", err)
+	}
+	if g.item, err = ParseDistribution(cfg.ItemDist, ItemCount, 8191, g.rand); err != nil {
+		return nil, fmt.Errorf("item distribution: %v", err)
+	}
+	return g, nil
+}
+
+// WriteFiles writes one file per client, named <client>.txt like the course's
+// transaction files.
+func (g *TxnGenerator) WriteFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i := 0; i < g.cfg.Clients; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%v.txt", i))
+		counts, err := g.writeFile(path)
+		if err != nil {
+			return fmt.Errorf("write %s failed: %v", path, err)
+		}
+		logs.Printf("generated %s: %v", path, formatTxnCounts(counts))
+	}
+	return nil
+}
+
+func (g *TxnGenerator) writeFile(path string) (map[string]int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	counts := make(map[string]int, 0)
+	for i := 0; i < g.cfg.Transactions; i++ {
+		t := g.nextType()
+		counts[t]++
+		for _, line := range g.command(t) {
+			w.WriteString(line)
+			w.WriteByte('\n')
+		}
+	}
+	return counts, w.Flush()
+}
+
+func (g *TxnGenerator) nextType() string {
+	x := g.rand.Float64() * g.cumWeights[len(g.cumWeights)-1]
+	i := sort.SearchFloat64s(g.cumWeights, x)
+	if i == len(g.types) {
+		i--
+	}
+	return g.types[i]
+}
+
+// maxItemDraws bounds the draws from the item distribution for the distinct
+// items of one NewOrder.
+const maxItemDraws = 10 * MaxNewOrderItems
+
+func (g *TxnGenerator) district() int64 {
+	return 1 + g.rand.Int63n(DistrictsPerWarehouse)
+}
+
+// command returns the lines of one transaction of type t.
+func (g *TxnGenerator) command(t string) []string {
+	r := g.rand
+	switch t {
+	case "N":
+		wid, did, cid := g.warehouse(r), g.district(), g.customer(r)
+		m := randInt(r, g.cfg.MinLines, g.cfg.MaxLines)
+		lines := []string{fmt.Sprintf("N,%v,%v,%v,%v", cid, wid, did, m)}
+		seen := make(map[int64]bool, m)
+		for draws := 0; len(lines) <= m; draws++ {
+			itemId := g.item(r)
+			if draws >= maxItemDraws {
+				// A steep skew keeps drawing the same few items: fill
+				// the order uniformly instead.
+				itemId = 1 + r.Int63n(ItemCount)
+			}
+			if seen[itemId] {
+				continue
+			}
+			seen[itemId] = true
+			supplyWid := wid
+			if g.warehouses > 1 && r.Float64() < g.cfg.RemoteProbability {
+				supplyWid = 1 + r.Int63n(g.warehouses-1)
+				if supplyWid >= wid {
+					supplyWid++
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%v,%v,%v", itemId, supplyWid, randInt(r, 1, 10)))
+		}
+		return lines
+	case "P":
+		return []string{fmt.Sprintf("P,%v,%v,%v,%s", g.warehouse(r), g.district(), g.customer(r), formatMoney(randFloat(r, 1, 5000)))}
+	case "D":
+		return []string{fmt.Sprintf("D,%v,%v", g.warehouse(r), randInt(r, 1, MaxCarrierId))}
+	case "O":
+		return []string{fmt.Sprintf("O,%v,%v,%v", g.warehouse(r), g.district(), g.customer(r))}
+	case "S":
+		return []string{fmt.Sprintf("S,%v,%v,%v,%v", g.warehouse(r), g.district(), randInt(r, 10, 20), randInt(r, 20, 30))}
+	case "I":
+		return []string{fmt.Sprintf("I,%v,%v,%v", g.warehouse(r), g.district(), randInt(r, 20, 30))}
+	case "T":
+		return []string{"T"}
+	case "R":
+		return []string{fmt.Sprintf("R,%v,%v,%v", g.warehouse(r), g.district(), g.customer(r))}
+	}
+	return nil
+}
+
+func formatTxnCounts(counts map[string]int) string {
+	parts := make([]string, 0, len(TxnTypes))
+	for _, t := range TxnTypes {
+		parts = append(parts, fmt.Sprintf("%s=%v", t, counts[t]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -2,30 +2,11 @@ package main
 
 import (
 	"fmt"
-	"math"
-	"math/rand"
-	"strconv"
 	"strings"
-	"time"
 )
 
 var ErrNoRowsAffected = fmt.Errorf("affected 0 rows")
 
-func SafeParseInt(s string) int {
-	res, _ := strconv.ParseInt(s, 10, 64)
-	return int(res)
-}
-
-func SafeParseInt64(s string) int64 {
-	res, _ := strconv.ParseInt(s, 10, 64)
-	return res
-}
-
-func SafeParseFloat64(s string) float64 {
-	res, _ := strconv.ParseFloat(s, 64)
-	return res
-}
-
 func FormatInt64Set(arr []int64) string {
 	sb := strings.Builder{}
 	sb.WriteString("(")
@@ -39,20 +20,22 @@ func FormatInt64Set(arr []int64) string {
 	return sb.String()
 }
 
-func Retry(query func() error) (err error) {
-	for i := 0; i < RetryTimes; i++ {
-		err = query()
-		if err == nil {
-			return nil
+// splitList splits a comma separated list, dropping blanks.
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-		time.Sleep(GetBackoffTime())
 	}
-	return fmt.Errorf("exceeds retry limit: %v", err)
+	return items
 }
 
-func GetBackoffTime() time.Duration {
-	dF := rand.Float64()*float64(BackOffTimeMax-BackoffTimeMin) + BackoffTimeMin
-	d := int(math.Round(dF))
-	duration, _ := time.ParseDuration(fmt.Sprintf("%vms", d))
-	return duration
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// idRange tracks the smallest and largest id seen.
+type idRange struct {
+	Min int64
+	Max int64
+	set bool
+}
+
+func (r *idRange) add(id int64) {
+	if !r.set || id < r.Min {
+		r.Min = id
+	}
+	if !r.set || id > r.Max {
+		r.Max = id
+	}
+	r.set = true
+}
+
+func (r *idRange) merge(o *idRange) {
+	if o.set {
+		r.add(o.Min)
+		r.add(o.Max)
+	}
+}
+
+func (r *idRange) String() string {
+	if !r.set {
+		return "none"
+	}
+	return fmt.Sprintf("%v-%v", r.Min, r.Max)
+}
+
+// fileSummary is what validate reports for one transaction file.
+type fileSummary struct {
+	Commands      int
+	Malformed     int
+	Counts        map[string]int
+	Warehouses    idRange
+	Districts     idRange
+	Customers     idRange
+	Items         idRange
+	NewOrderLines int
+}
+
+func newFileSummary() *fileSummary {
+	return &fileSummary{Counts: make(map[string]int, 0)}
+}
+
+func (s *fileSummary) add(cmd TxnCommand) {
+	s.Commands++
+	s.Counts[cmd.Type()]++
+	switch c := cmd.(type) {
+	case *NewOrderCmd:
+		s.Warehouses.add(c.Wid)
+		s.Districts.add(c.Did)
+		s.Customers.add(c.Cid)
+		s.NewOrderLines += len(c.Items)
+		for _, item := range c.Items {
+			s.Warehouses.add(item.SupplyWid)
+			s.Items.add(item.ItemId)
+		}
+	case *PaymentCmd:
+		s.Warehouses.add(c.Wid)
+		s.Districts.add(c.Did)
+		s.Customers.add(c.Cid)
+	case *DeliveryCmd:
+		s.Warehouses.add(c.Wid)
+	case *OrderStatusCmd:
+		s.Warehouses.add(c.Wid)
+		s.Districts.add(c.Did)
+		s.Customers.add(c.Cid)
+	case *StockLevelCmd:
+		s.Warehouses.add(c.Wid)
+		s.Districts.add(c.Did)
+	case *PopularItemCmd:
+		s.Warehouses.add(c.Wid)
+		s.Districts.add(c.Did)
+	case *RelatedCustomerCmd:
+		s.Warehouses.add(c.Wid)
+		s.Districts.add(c.Did)
+		s.Customers.add(c.Cid)
+	}
+}
+
+func (s *fileSummary) merge(o *fileSummary) {
+	s.Commands += o.Commands
+	s.Malformed += o.Malformed
+	for t, n := range o.Counts {
+		s.Counts[t] += n
+	}
+	s.Warehouses.merge(&o.Warehouses)
+	s.Districts.merge(&o.Districts)
+	s.Customers.merge(&o.Customers)
+	s.Items.merge(&o.Items)
+	s.NewOrderLines += o.NewOrderLines
+}
+
+func (s *fileSummary) print(name string) {
+	logs.Printf("%s: %v commands, %v malformed", name, s.Commands, s.Malformed)
+	logs.Printf("  types: %s", formatTxnCounts(s.Counts))
+	logs.Printf("  warehouses: %v, districts: %v, customers: %v, items: %v", &s.Warehouses, &s.Districts, &s.Customers, &s.Items)
+	avg := 0.0
+	if s.Counts["N"] > 0 {
+		avg = float64(s.NewOrderLines) / float64(s.Counts["N"])
+	}
+	logs.Printf("  NewOrder lines: %v (%.2f per order)", s.NewOrderLines, avg)
+}
+
+// validateFile parses path and logs every malformed command.
+func validateFile(path string) (*fileSummary, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	summary := newFileSummary()
+	parser := NewParser(file, path)
+	for {
+		cmd, err := parser.Next()
+		if err == io.EOF {
+			return summary, nil
+		} else if perr, ok := err.(*ParseError); ok {
+			logs.Printf("malformed command: %v", perr)
+			summary.Malformed++
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		summary.add(cmd)
+	}
+}
+
+// validateCommand is the offline dry run of the transaction files: it parses
+// them like run does, without connecting to the database, and fails if any
+// file cannot be read or holds a malformed command.
+func validateCommand(cfg *Config, args []string) error {
+	files := cfg.Files
+	if len(args) > 0 {
+		files = args
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no transaction files: pass them as arguments or set files")
+	}
+
+	total := newFileSummary()
+	unreadable := 0
+	for _, path := range files {
+		summary, err := validateFile(path)
+		if err != nil {
+			logs.Printf("%s: %v", path, err)
+			unreadable++
+			continue
+		}
+		summary.print(path)
+		total.merge(summary)
+	}
+	total.print(fmt.Sprintf("total of %v files", len(files)-unreadable))
+
+	if unreadable > 0 || total.Malformed > 0 {
+		return fmt.Errorf("%v unreadable files, %v malformed commands", unreadable, total.Malformed)
+	}
+	return nil
+}
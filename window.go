@@ -0,0 +1,108 @@
+package main
+
+import "time"
+
+// windowRecord is a transaction held back until it is known to be outside
+// the cool-down tail.
+type windowRecord struct {
+	TxnType string        `json:"type"`
+	Outcome Outcome       `json:"outcome"`
+	Retries int           `json:"retries"`
+	Latency time.Duration `json:"latency"`
+	End     time.Time     `json:"end"`
+}
+
+// windowState is what a checkpoint keeps of a MeasurementWindow.
+type windowState struct {
+	Started  time.Time       `json:"started"`
+	Executed int             `json:"executed"`
+	Warm     bool            `json:"warm"`
+	Tail     []*windowRecord `json:"tail"`
+}
+
+// MeasurementWindow feeds ClientMetrics only the transactions between the
+// warm-up and the cool-down, which still run but are not reported. The warm-up
+// lasts until both its time and its count have passed. The end of a run is
+// not known in advance, so the transactions of the last cool-down time, and at
+// least the last cool-down count of them, are held back and dropped when the
+// client finishes.
+type MeasurementWindow struct {
+	cfg      MeasureConfig
+	metrics  *ClientMetrics
+	started  time.Time
+	executed int
+	warm     bool
+	tail     []*windowRecord
+}
+
+func NewMeasurementWindow(cfg MeasureConfig, metrics *ClientMetrics) *MeasurementWindow {
+	w := &MeasurementWindow{cfg: cfg, metrics: metrics, started: metrics.Start}
+	w.warm = cfg.WarmupTime <= 0 && cfg.WarmupCount <= 0
+	return w
+}
+
+func (w *MeasurementWindow) hasCooldown() bool {
+	return w.cfg.CooldownTime > 0 || w.cfg.CooldownCount > 0
+}
+
+// Record adds a transaction that ended at end.
+func (w *MeasurementWindow) Record(txnType string, outcome Outcome, retries int, latency time.Duration, end time.Time) {
+	w.executed++
+	if !w.warm {
+		w.metrics.Warmup++
+		if end.Sub(w.started) >= w.cfg.WarmupTime && w.executed >= w.cfg.WarmupCount {
+			// The measurement starts with the next transaction.
+			w.warm = true
+			w.metrics.Start = end
+		}
+		return
+	}
+	if !w.hasCooldown() {
+		w.metrics.Record(txnType, outcome, retries, latency)
+		return
+	}
+
+	w.tail = append(w.tail, &windowRecord{TxnType: txnType, Outcome: outcome, Retries: retries, Latency: latency, End: end})
+	n := 0
+	for n < len(w.tail)-w.cfg.CooldownCount && end.Sub(w.tail[n].End) > w.cfg.CooldownTime {
+		r := w.tail[n]
+		w.metrics.Record(r.TxnType, r.Outcome, r.Retries, r.Latency)
+		w.metrics.End = r.End
+		n++
+	}
+	w.tail = w.tail[n:]
+}
+
+// Finish ends the measurement of a client that finished at end, dropping the
+// cool-down tail.
+func (w *MeasurementWindow) Finish(end time.Time) {
+	if !w.warm {
+		// The client finished during the warm-up: nothing was measured.
+		w.metrics.Start = end
+		w.metrics.End = end
+		return
+	}
+	if !w.hasCooldown() {
+		w.metrics.End = end
+		return
+	}
+	w.metrics.Cooldown += int64(len(w.tail))
+	w.tail = nil
+	if w.metrics.End.Before(w.metrics.Start) {
+		w.metrics.End = w.metrics.Start
+	}
+}
+
+func (w *MeasurementWindow) state() *windowState {
+	return &windowState{Started: w.started, Executed: w.executed, Warm: w.warm, Tail: w.tail}
+}
+
+// restoreMeasurementWindow continues the window of a checkpoint, its times
+// shifted by gap.
+func restoreMeasurementWindow(cfg MeasureConfig, metrics *ClientMetrics, st *windowState, gap time.Duration) *MeasurementWindow {
+	w := &MeasurementWindow{cfg: cfg, metrics: metrics, started: st.Started.Add(gap), executed: st.Executed, warm: st.Warm, tail: st.Tail}
+	for _, r := range w.tail {
+		r.End = r.End.Add(gap)
+	}
+	return w
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeasurementWindow(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  MeasureConfig
+		// Transactions end one second apart, the first 1s after the start.
+		transactions int
+		wantMeasured int64
+		wantWarmup   int64
+		wantCooldown int64
+		wantStart    time.Duration
+		wantEnd      time.Duration
+	}{
+		{"everything", MeasureConfig{}, 10, 10, 0, 0, 0, 10 * time.Second},
+		{"warm-up count", MeasureConfig{WarmupCount: 3}, 10, 7, 3, 0, 3 * time.Second, 10 * time.Second},
+		{"warm-up time", MeasureConfig{WarmupTime: 4 * time.Second}, 10, 6, 4, 0, 4 * time.Second, 10 * time.Second},
+		// Both have to pass: the count takes longer here.
+		{"warm-up time and count", MeasureConfig{WarmupTime: 2 * time.Second, WarmupCount: 5}, 10, 5, 5, 0, 5 * time.Second, 10 * time.Second},
+		{"cool-down count", MeasureConfig{CooldownCount: 2}, 10, 8, 0, 2, 0, 8 * time.Second},
+		{"cool-down time", MeasureConfig{CooldownTime: 3 * time.Second}, 10, 6, 0, 4, 0, 6 * time.Second},
+		{"warm-up and cool-down", MeasureConfig{WarmupCount: 2, CooldownCount: 2}, 10, 6, 2, 2, 2 * time.Second, 8 * time.Second},
+		{"finished during the warm-up", MeasureConfig{WarmupCount: 20}, 10, 0, 10, 0, 10 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+			metrics := NewClientMetrics(0, "test.txt")
+			metrics.Start = start
+			w := NewMeasurementWindow(tt.cfg, metrics)
+			end := start
+			for i := 0; i < tt.transactions; i++ {
+				end = end.Add(time.Second)
+				w.Record("P", OutcomeCommitted, 0, time.Millisecond, end)
+			}
+			w.Finish(end)
+
+			if got := metrics.Committed(); got != tt.wantMeasured {
+				t.Errorf("measured %v transactions, want %v", got, tt.wantMeasured)
+			}
+			if metrics.Warmup != tt.wantWarmup || metrics.Cooldown != tt.wantCooldown {
+				t.Errorf("left out %v warm-up and %v cool-down, want %v and %v", metrics.Warmup, metrics.Cooldown, tt.wantWarmup, tt.wantCooldown)
+			}
+			if got := metrics.Start.Sub(start); got != tt.wantStart {
+				t.Errorf("start at %v, want %v", got, tt.wantStart)
+			}
+			if got := metrics.End.Sub(start); got != tt.wantEnd {
+				t.Errorf("end at %v, want %v", got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestMeasurementWindowRestore(t *testing.T) {
+	start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	metrics := NewClientMetrics(0, "test.txt")
+	metrics.Start = start
+	w := NewMeasurementWindow(MeasureConfig{WarmupCount: 1, CooldownCount: 2}, metrics)
+	for i := 1; i <= 4; i++ {
+		w.Record("P", OutcomeCommitted, 0, time.Millisecond, start.Add(time.Duration(i)*time.Second))
+	}
+
+	// Resumed an hour later, the held back tail is still measured.
+	gap := time.Hour
+	restored := restoreMeasurementWindow(w.cfg, metrics, w.state(), gap)
+	end := start.Add(gap + 4*time.Second)
+	for i := 0; i < 3; i++ {
+		end = end.Add(time.Second)
+		restored.Record("P", OutcomeCommitted, 0, time.Millisecond, end)
+	}
+	restored.Finish(end)
+	if metrics.Warmup != 1 || metrics.Committed() != 4 || metrics.Cooldown != 2 {
+		t.Errorf("warm-up %v, measured %v, cool-down %v, want 1, 4 and 2", metrics.Warmup, metrics.Committed(), metrics.Cooldown)
+	}
+}